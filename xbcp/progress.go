@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+type Progress int
+
+const (
+	Auto Progress = iota
+	None
+	Bar
+	JSON
+)
+
+var progressStrings = []string{
+	Auto: "Auto",
+	None: "None",
+	Bar:  "Bar",
+	JSON: "JSON",
+}
+
+func (p Progress) String() string {
+	return progressStrings[p]
+}
+
+func (p *Progress) Set(value string) error {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case strings.ToUpper(Auto.String()):
+		*p = Auto
+	case strings.ToUpper(None.String()):
+		*p = None
+	case strings.ToUpper(Bar.String()):
+		*p = Bar
+	case strings.ToUpper(JSON.String()):
+		*p = JSON
+	default:
+		return fmt.Errorf("Invalid progress mode. Got \"%s\", expected one of %s", value, progressList())
+	}
+
+	return nil
+}
+
+func progressList() string {
+	return fmt.Sprintf("\"%s\"", strings.Join(progressStrings, "\", \""))
+}
+
+// Resolve Auto to a progress bar when stderr is a terminal.
+func (p Progress) resolve() Progress {
+	if p != Auto {
+		return p
+	}
+
+	if stat, err := os.Stderr.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 && !verbose {
+		return Bar
+	}
+
+	return None
+}
+
+// Transfer counts the bytes written to it and reports progress at every
+// interval until finished.
+type Transfer struct {
+	source string
+	dest   string
+	offset int64
+	total  int64
+	count  int64
+	start  time.Time
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type progressEvent struct {
+	Source  string  `json:"source"`
+	Dest    string  `json:"dest"`
+	Status  string  `json:"status"`
+	Bytes   int64   `json:"bytes"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+	Rate    float64 `json:"rate"`
+	ETA     float64 `json:"eta"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Start reporting progress for a transfer of total bytes, of which offset
+// bytes were transferred previously.
+func startTransfer(source, dest string, offset, total int64) *Transfer {
+	t := &Transfer{
+		source: source,
+		dest:   dest,
+		offset: offset,
+		total:  total,
+		count:  offset,
+		start:  time.Now(),
+		stop:   make(chan struct{}),
+	}
+
+	switch progressMode {
+	case None:
+		if !verbose {
+			fmt.Printf("Copying %s (%d bytes) to %s... ", displayName(source), total, displayName(dest))
+		}
+	case Bar, JSON:
+		t.wg.Add(1)
+		go t.run()
+	}
+
+	return t
+}
+
+func (t *Transfer) Write(p []byte) (int, error) {
+	atomic.AddInt64(&t.count, int64(len(p)))
+	return len(p), nil
+}
+
+func (t *Transfer) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.report("progress", nil)
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Finish stops progress reporting and prints the outcome of the transfer.
+func (t *Transfer) Finish(err error) {
+	close(t.stop)
+	t.wg.Wait()
+
+	status := "done"
+	if err != nil {
+		status = "failed"
+	}
+
+	switch progressMode {
+	case None:
+		if verbose {
+			return
+		} else if err != nil {
+			fmt.Println("Failed")
+		} else {
+			fmt.Println("Success")
+		}
+	case Bar:
+		// Clear the progress bar.
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+
+		if err != nil {
+			fmt.Printf("Copying %s to %s... Failed\n", displayName(t.source), displayName(t.dest))
+		} else {
+			fmt.Printf("Copying %s (%s) to %s... Success (%s/s)\n", displayName(t.source), xbdm.FormatSize(t.total), displayName(t.dest), xbdm.FormatSize(int64(t.rate())))
+		}
+	case JSON:
+		t.report(status, err)
+	}
+}
+
+func (t *Transfer) rate() float64 {
+	elapsed := time.Since(t.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(atomic.LoadInt64(&t.count)-t.offset) / elapsed
+}
+
+func (t *Transfer) report(status string, err error) {
+	count := atomic.LoadInt64(&t.count)
+	rate := t.rate()
+
+	percent := 100.0
+	if t.total > 0 {
+		percent = float64(count) * 100 / float64(t.total)
+	}
+
+	eta := 0.0
+	if rate > 0 {
+		eta = float64(t.total-count) / rate
+	}
+
+	switch progressMode {
+	case Bar:
+		fmt.Fprintf(os.Stderr, "\r\x1b[K%s %s %10s / %-10s %5.1f%% %10s/s  ETA %s",
+			displayName(t.source), bar(percent, 20), xbdm.FormatSize(count), xbdm.FormatSize(t.total), percent, xbdm.FormatSize(int64(rate)),
+			time.Duration(eta*float64(time.Second)).Round(time.Second))
+	case JSON:
+		event := progressEvent{
+			Source:  t.source,
+			Dest:    t.dest,
+			Status:  status,
+			Bytes:   count,
+			Total:   t.total,
+			Percent: percent,
+			Rate:    rate,
+			ETA:     eta,
+		}
+
+		if err != nil {
+			event.Error = err.Error()
+		}
+
+		line, _ := json.Marshal(event)
+		fmt.Println(string(line))
+	}
+}
+
+func reportSkipped(source, dest string) {
+	line, _ := json.Marshal(progressEvent{Source: source, Dest: dest, Status: "skipped"})
+	fmt.Println(string(line))
+}
+
+func bar(percent float64, width int) string {
+	filled := int(percent / 100 * float64(width))
+	if filled > width {
+		filled = width
+	}
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(" ", width-filled) + "]"
+}
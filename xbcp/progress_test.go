@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run f and return the lines it printed to stdout.
+func captureStdout(t *testing.T, f func()) []string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+
+	f()
+	w.Close()
+
+	return strings.Split(strings.TrimSuffix(string(<-output), "\n"), "\n")
+}
+
+// Decode a JSON event, keeping the field names as printed.
+func decodeEvent(t *testing.T, line string) map[string]any {
+	t.Helper()
+
+	var event map[string]any
+
+	err := json.Unmarshal([]byte(line), &event)
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+
+	return event
+}
+
+func TestProgressJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+		total  int64
+		write  int
+		err    error
+		want   map[string]any
+	}{
+		{
+			name: "done", total: 10, write: 10,
+			want: map[string]any{"status": "done", "bytes": 10.0, "total": 10.0, "percent": 100.0, "eta": 0.0},
+		},
+		{
+			name: "resumed", offset: 4, total: 10, write: 6,
+			want: map[string]any{"status": "done", "bytes": 10.0, "total": 10.0, "percent": 100.0, "eta": 0.0},
+		},
+		{
+			name: "empty", total: 0,
+			want: map[string]any{"status": "done", "bytes": 0.0, "total": 0.0, "percent": 100.0, "eta": 0.0},
+		},
+		{
+			name: "failed", total: 10, write: 5, err: errors.New("Connection reset"),
+			want: map[string]any{"status": "failed", "bytes": 5.0, "total": 10.0, "percent": 50.0, "error": "Connection reset"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			verbose, progressMode, progressInterval = false, JSON, time.Hour
+
+			lines := captureStdout(t, func() {
+				transfer := startTransfer("save.xbx", "kit3:E:\\save.xbx", tt.offset, tt.total)
+				transfer.Write(make([]byte, tt.write))
+				transfer.Finish(tt.err)
+			})
+
+			if len(lines) != 1 {
+				t.Fatalf("Printed %q, want one event", lines)
+			}
+
+			event := decodeEvent(t, lines[0])
+
+			if event["source"] != "save.xbx" || event["dest"] != "kit3:E:\\save.xbx" {
+				t.Errorf("Got source %v and dest %v, want save.xbx and kit3:E:\\save.xbx", event["source"], event["dest"])
+			}
+
+			for key, want := range tt.want {
+				if event[key] != want {
+					t.Errorf("Got %s %v, want %v", key, event[key], want)
+				}
+			}
+
+			if _, ok := event["error"]; ok && tt.err == nil {
+				t.Errorf("Got error %v, want none", event["error"])
+			}
+
+			for _, key := range []string{"rate", "eta"} {
+				if _, ok := event[key].(float64); !ok {
+					t.Errorf("Got %s %v, want a number", key, event[key])
+				}
+			}
+		})
+	}
+}
+
+func TestReportSkipped(t *testing.T) {
+	lines := captureStdout(t, func() { reportSkipped("save.xbx", "kit3:E:\\save.xbx") })
+
+	want := map[string]any{
+		"source":  "save.xbx",
+		"dest":    "kit3:E:\\save.xbx",
+		"status":  "skipped",
+		"bytes":   0.0,
+		"total":   0.0,
+		"percent": 0.0,
+		"rate":    0.0,
+		"eta":     0.0,
+	}
+
+	if len(lines) != 1 {
+		t.Fatalf("Printed %q, want one event", lines)
+	} else if event := decodeEvent(t, lines[0]); !reflect.DeepEqual(event, want) {
+		t.Errorf("Got %v, want %v", event, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+const (
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+var errVerify = errors.New("Verification failed")
+
+// Network failures and failed verifications are worth retrying, while
+// command errors, local file errors and hosts not found are not.
+func isTransient(err error) bool {
+	var cmderr *xbdm.Error
+	var dnserr *net.DNSError
+	var neterr net.Error
+
+	switch {
+	case errors.As(err, &cmderr),
+		errors.As(err, &dnserr):
+		return false
+	case errors.Is(err, errVerify),
+		errors.As(err, &neterr),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+
+	return false
+}
+
+// Call fn until it succeeds, retrying transient failures with exponential
+// backoff.
+func retry(fn func() error) error {
+	delay := retryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > retries || !isTransient(err) {
+			return err
+		}
+
+		log.Printf("Attempt %d failed: %s. Retrying in %s", attempt, err, delay)
+
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func verifyRemote(c *xbdm.Client, destpath string, length int64) error {
+	stat, err := c.Stat(destpath)
+	if err != nil {
+		return err
+	} else if stat.Size != length {
+		return fmt.Errorf("%w: Remote size is %d bytes, expected %d", errVerify, stat.Size, length)
+	}
+
+	if verbose {
+		log.Printf("Verified remote size of \"%s\"", destpath)
+	}
+
+	return nil
+}
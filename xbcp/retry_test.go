@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+func TestIsTransient(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", Name: "kit3.lan", IsNotFound: true}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"none", nil, false},
+		{"command error", fmt.Errorf("Copying failed: %w", &xbdm.Error{Status: xbdm.StatusDeviceFull}), false},
+		{"verification", fmt.Errorf("%w: Remote size is 1 bytes, expected 2", errVerify), true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"timeout", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"broken pipe", fmt.Errorf("Sending failed: %w", syscall.EPIPE), true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("Reading failed: %w", io.ErrUnexpectedEOF), true},
+		{"host not found", &net.OpError{Op: "dial", Net: "tcp", Err: notFound}, false},
+		{"console not found", fmt.Errorf("%w: \"kit3\"", xbdm.ErrConsoleNotFound), false},
+		{"local file", &fs.PathError{Op: "open", Path: "default.xbe", Err: fs.ErrNotExist}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errCommand := &xbdm.Error{Status: xbdm.StatusAccessDenied}
+	errHost := &net.DNSError{Err: "no such host", Name: "kit3.lan", IsNotFound: true}
+
+	tests := []struct {
+		name    string
+		retries int
+		errs    []error
+		calls   int
+		want    error
+	}{
+		{name: "success", retries: 3, errs: []error{nil}, calls: 1},
+		{name: "no retries", errs: []error{io.EOF, nil}, calls: 1, want: io.EOF},
+		{name: "retried", retries: 1, errs: []error{io.EOF, nil}, calls: 2},
+		{name: "command error", retries: 3, errs: []error{errCommand, nil}, calls: 1, want: errCommand},
+		{name: "host not found", retries: 3, errs: []error{errHost, nil}, calls: 1, want: errHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retries = tt.retries
+			calls := 0
+
+			err := retry(func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+
+			if calls != tt.calls {
+				t.Errorf("Called %d times, want %d", calls, tt.calls)
+			}
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
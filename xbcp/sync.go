@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+// FATX timestamps have a resolution of two seconds.
+const timeTolerance = 2 * time.Second
+
+var unchanged int
+
+func syncFiles(sourcedir, destfilename string) error {
+	stat, err := os.Stat(sourcedir)
+	if err != nil {
+		return err
+	} else if !stat.IsDir() {
+		return fmt.Errorf("Sync source \"%s\" is not a directory", sourcedir)
+	}
+
+	desthost, destpath, err := parseRemote(destfilename)
+	if err != nil {
+		return err
+	}
+
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return err
+	}
+
+	// Create the destination unless it is a drive root.
+	if dir := strings.TrimRight(destpath, string(xbdm.PathSeparator)); !xbdm.IsRoot(dir) {
+		if verbose {
+			log.Printf("Creating remote directory \"%s\"", dir)
+		}
+
+		err = destclient.MkdirAll(dir)
+		if err != nil {
+			pool.Check(desthost, err)
+			return err
+		}
+	}
+
+	err = syncDir(desthost, sourcedir, destpath)
+
+	if !verbose && progressMode != JSON {
+		fmt.Printf("%d files copied, %d up to date\n", copied, unchanged)
+	}
+
+	return err
+}
+
+func isUnchanged(local os.FileInfo, remote *xbdm.FileInfo) bool {
+	if remote.IsDir || local.Size() != remote.Size {
+		return false
+	}
+
+	diff := local.ModTime().Sub(remote.Changed)
+
+	return diff < timeTolerance && diff > -timeTolerance
+}
+
+// Upload the files in sourcedir that differ from destpath by size or
+// modification time, optionally deleting remote files missing locally.
+func syncDir(desthost, sourcedir, destpath string) error {
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return err
+	}
+
+	files, err := destclient.DirList(destpath)
+	if err != nil {
+		pool.Check(desthost, err)
+		return err
+	}
+
+	// FATX file names are case insensitive.
+	remote := make(map[string]*xbdm.FileInfo, len(files))
+	for _, file := range files {
+		remote[strings.ToLower(file.Name)] = file
+	}
+
+	entries, err := os.ReadDir(sourcedir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		sourcename := filepath.Join(sourcedir, entry.Name())
+		destname := xbdm.Join(destpath, entry.Name())
+
+		file := remote[strings.ToLower(entry.Name())]
+		delete(remote, strings.ToLower(entry.Name()))
+
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			log.Printf("Skipping \"%s\": Not a regular file", sourcename)
+			continue
+		}
+
+		// Replace remote entries of the wrong type.
+		if file != nil && file.IsDir != entry.IsDir() {
+			if !deleteExtra {
+				report(fmt.Errorf("Type of %s:\"%s\" differs from \"%s\", use -delete to replace it", desthost, destname, sourcename))
+				continue
+			}
+
+			err = removeRemote(desthost, destname)
+			if err != nil {
+				report(err)
+				continue
+			}
+
+			file = nil
+		}
+
+		if entry.IsDir() {
+			if file == nil {
+				err = mkdirRemote(desthost, destname)
+				if err != nil {
+					report(err)
+					continue
+				}
+			}
+
+			report(syncDir(desthost, sourcename, destname))
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			report(err)
+			continue
+		}
+
+		if file != nil && isUnchanged(info, file) {
+			if verbose {
+				log.Printf("Up to date: %s", displayName(desthost+":"+destname))
+			}
+
+			unchanged++
+			continue
+		}
+
+		err = uploadFile(desthost, sourcename, destname)
+		if err == nil {
+			err = setRemoteTime(desthost, destname, info.ModTime())
+		}
+
+		report(err)
+	}
+
+	if deleteExtra {
+		for _, file := range remote {
+			report(removeRemote(desthost, xbdm.Join(destpath, file.Name)))
+		}
+	}
+
+	return nil
+}
+
+// The pooled connection is fetched again for every command, as a failed
+// upload may have replaced it.
+func mkdirRemote(desthost, destpath string) error {
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		log.Printf("Creating remote directory \"%s\"", destpath)
+	}
+
+	err = destclient.Mkdir(destpath)
+	if err != nil {
+		pool.Check(desthost, err)
+		return fmt.Errorf("Creating %s failed: %w", displayName(desthost+":"+destpath), err)
+	}
+
+	return nil
+}
+
+// Keep the local modification time so unchanged files are detected on the
+// next sync.
+func setRemoteTime(desthost, destpath string, changed time.Time) error {
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return err
+	}
+
+	err = destclient.SetFileTime(destpath, changed, changed)
+	if err != nil {
+		pool.Check(desthost, err)
+		return fmt.Errorf("Setting time of %s failed: %w", displayName(desthost+":"+destpath), err)
+	}
+
+	return nil
+}
+
+func removeRemote(desthost, destpath string) error {
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return err
+	}
+
+	if !verbose && progressMode != JSON {
+		fmt.Printf("Deleting %s\n", displayName(desthost+":"+destpath))
+	} else if verbose {
+		log.Printf("Deleting %s", displayName(desthost+":"+destpath))
+	}
+
+	err = destclient.RemoveAll(destpath)
+	if err != nil {
+		pool.Check(desthost, err)
+		return fmt.Errorf("Deleting %s failed: %w", displayName(desthost+":"+destpath), err)
+	}
+
+	return nil
+}
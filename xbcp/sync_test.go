@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+// Marks directories in the trees compared by the sync tests.
+const dirEntry = "<dir>"
+
+var syncTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// Create files and directories with the modification time syncTime, unless
+// they're listed in changed.
+func writeTree(t *testing.T, root string, tree map[string]string, changed ...string) {
+	t.Helper()
+
+	for name, data := range tree {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if data == dirEntry {
+			err := os.MkdirAll(path, 0777)
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			writeFile(t, path, data)
+		}
+	}
+
+	for name := range tree {
+		mtime := syncTime
+		for _, c := range changed {
+			if c == name {
+				mtime = syncTime.Add(time.Hour)
+			}
+		}
+
+		err := os.Chtimes(filepath.Join(root, filepath.FromSlash(name)), mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	tree := map[string]string{}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		name, _ := filepath.Rel(root, path)
+
+		if d.IsDir() {
+			tree[filepath.ToSlash(name)] = dirEntry
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		tree[filepath.ToSlash(name)] = string(data)
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+// Hang up on the first command, then serve the rest with handler.
+func hangupOnce(handler xbdmtest.Handler) xbdmtest.Handler {
+	var calls atomic.Int32
+
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		if calls.Add(1) == 1 {
+			c.Close()
+			return
+		}
+
+		handler(c, cmd)
+	}
+}
+
+func TestSync(t *testing.T) {
+	local := map[string]string{
+		"a.txt":   "alpha",
+		"b":       dirEntry,
+		"b/c.txt": "charlie",
+	}
+
+	tests := []struct {
+		name    string
+		remote  map[string]string
+		changed []string
+		delete  bool
+		retries int
+		setup   func(s *xbdmtest.Server)
+		want    map[string]string
+		copied  int
+		failed  int
+	}{
+		{name: "new", want: local, copied: 2},
+		{
+			// Same size and time, so the content isn't compared.
+			name:   "unchanged",
+			remote: map[string]string{"a.txt": "ALPHA", "b": dirEntry, "b/c.txt": "CHARLIE"},
+			want:   map[string]string{"a.txt": "ALPHA", "b": dirEntry, "b/c.txt": "CHARLIE"},
+		},
+		{
+			name:   "changed size",
+			remote: map[string]string{"a.txt": "old", "b": dirEntry, "b/c.txt": "CHARLIE"},
+			want:   map[string]string{"a.txt": "alpha", "b": dirEntry, "b/c.txt": "CHARLIE"},
+			copied: 1,
+		},
+		{
+			name:    "changed time",
+			remote:  map[string]string{"a.txt": "ALPHA", "b": dirEntry, "b/c.txt": "CHARLIE"},
+			changed: []string{"b/c.txt"},
+			want:    map[string]string{"a.txt": "ALPHA", "b": dirEntry, "b/c.txt": "charlie"},
+			copied:  1,
+		},
+		{
+			name:   "extra kept",
+			remote: map[string]string{"extra.txt": "x", "b": dirEntry, "b/old": dirEntry, "b/old/d.txt": "d"},
+			want: map[string]string{
+				"a.txt": "alpha", "b": dirEntry, "b/c.txt": "charlie",
+				"extra.txt": "x", "b/old": dirEntry, "b/old/d.txt": "d",
+			},
+			copied: 2,
+		},
+		{
+			name:   "delete extra",
+			remote: map[string]string{"extra.txt": "x", "b": dirEntry, "b/old": dirEntry, "b/old/d.txt": "d"},
+			delete: true,
+			want:   local,
+			copied: 2,
+		},
+		{
+			name:   "type mismatch",
+			remote: map[string]string{"a.txt": dirEntry, "a.txt/e.txt": "e", "b": "bravo"},
+			want:   map[string]string{"a.txt": dirEntry, "a.txt/e.txt": "e", "b": "bravo"},
+			failed: 2,
+		},
+		{
+			name:   "type mismatch deleted",
+			remote: map[string]string{"a.txt": dirEntry, "a.txt/e.txt": "e", "b": "bravo"},
+			delete: true,
+			want:   local,
+			copied: 2,
+		},
+		{
+			// The connection replaced after the retry is used for the
+			// following directory.
+			name:    "retry after hangup",
+			retries: 2,
+			setup:   func(s *xbdmtest.Server) { s.Handle("sendfile", hangupOnce(storeSendFile(-1))) },
+			want:    local,
+			copied:  2,
+		},
+		{
+			name:   "upload failure",
+			setup:  func(s *xbdmtest.Server) { s.Handle("sendfile", xbdmtest.Hangup()) },
+			want:   map[string]string{"b": dirEntry},
+			failed: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			syncMode, deleteExtra, retries = true, tt.delete, tt.retries
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			source := t.TempDir()
+			writeTree(t, source, local)
+
+			dest := filepath.Join(server.Root, "E", "sync")
+			writeTree(t, dest, tt.remote, tt.changed...)
+
+			report(syncFiles(source, server.Addr()+`:E:\sync`))
+
+			if copied != tt.copied || failed != tt.failed {
+				t.Errorf("%d copied and %d failed, want %d and %d", copied, failed, tt.copied, tt.failed)
+			}
+
+			if got := readTree(t, dest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Synced %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
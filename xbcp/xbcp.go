@@ -1,31 +1,41 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
-)
+	"time"
 
-const (
-	DebugBiosPort      = 731
-	ResponseOk         = "200- OK"
-	ResponseQuit       = "200- bye"
-	ResponseBanner     = "201- connected"
-	ResponseSendBinary = "204- send binary data"
-	CommandSendFile    = "sendfile name=\"%s\" length=0x%x"
-	CommandQuit        = "bye"
-	MessageSuffix      = "\r\n"
-	XboxPathSeparator  = '\\'
+	"github.com/dstien/dutils/xbdm"
 )
 
 var (
-	verbose bool
+	verbose     bool
+	recursive   bool
+	noClobber   bool
+	parents     bool
+	syncMode    bool
+	deleteExtra bool
+	verify      bool
+	resume      bool
+	retries     int
+
+	progressMode     Progress
+	progressInterval time.Duration
+
+	// Connections are kept open for the whole batch.
+	pool xbdm.Pool
+
+	copied int
+	failed int
+
+	// Named consoles and the default console.
+	config *xbdm.Config
 )
 
 func openLocal(name string) (file *os.File, length int64, err error) {
@@ -47,158 +57,499 @@ func openLocal(name string) (file *os.File, length int64, err error) {
 	return file, length, err
 }
 
-func parseRemote(name, localfile string) (host, path string, err error) {
-	dest := strings.SplitN(name, ":", 2)
+func isRemote(name string) bool {
+	return config.IsRemote(name)
+}
 
-	if len(dest) != 2 || dest[0] == "" || dest[1] == "" {
-		return "", "", fmt.Errorf("Destination filename must be on the format \"host:X:\\full\\path\\file\"")
+// Quote the path of a local or remote filename for display.
+func displayName(name string) string {
+	if host, path, err := config.ParseRemote(name); err == nil {
+		return fmt.Sprintf("%s:\"%s\"", host, path)
 	}
 
-	host = dest[0]
-	path = dest[1]
+	return fmt.Sprintf("\"%s\"", name)
+}
 
-	// Append local filename if remote path is a directory.
-	if strings.HasSuffix(path, string(XboxPathSeparator)) {
-		path += localfile
+func parseRemote(name string) (host, path string, err error) {
+	host, path, err = config.ParseRemote(name)
+	if err != nil {
+		return "", "", err
 	}
 
 	if verbose {
-		log.Printf("Destination host: \"%s\"", host)
-		log.Printf("Destination file: \"%s\"", path)
+		log.Printf("Remote host: \"%s\"", host)
+		log.Printf("Remote file: \"%s\"", path)
 	}
 
 	return host, path, nil
 }
 
-func connect(host string) (conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, err error) {
-	socket := fmt.Sprintf("%s:%d", host, DebugBiosPort)
-
-	if verbose {
-		log.Printf("Connecting to %s", socket)
+func skip(source, dest string) {
+	if progressMode == JSON {
+		reportSkipped(source, dest)
+	} else if !verbose {
+		fmt.Printf("Skipping existing %s\n", displayName(dest))
+	} else {
+		log.Printf("Skipping existing %s", displayName(dest))
 	}
+}
 
-	conn, err = net.Dial("tcp4", socket)
+func report(err error) {
 	if err != nil {
-		return nil, nil, nil, err
+		failed++
+		log.Print(err)
+	}
+}
+
+func copyFiles(sources []string, dest string) {
+	// Multiple sources are copied into the destination directory.
+	if len(sources) > 1 {
+		if isRemote(dest) {
+			if !strings.HasSuffix(dest, string(xbdm.PathSeparator)) {
+				dest += string(xbdm.PathSeparator)
+			}
+		} else if stat, err := os.Stat(dest); err != nil || !stat.IsDir() {
+			log.Fatalf("Target \"%s\" is not a directory", dest)
+		}
 	}
 
-	reader = bufio.NewReader(conn)
-	writer = bufio.NewWriter(conn)
+	if syncMode {
+		if len(sources) != 1 || isRemote(sources[0]) || !isRemote(dest) {
+			log.Fatal("Sync requires one local source directory and a remote destination")
+		} else if noClobber {
+			log.Fatal("The -n flag can not be combined with -sync")
+		}
 
-	_, err = readResponse(reader, ResponseBanner)
+		report(syncFiles(sources[0], dest))
+	} else {
+		for _, source := range sources {
+			if isRemote(source) {
+				if isRemote(dest) {
+					report(fmt.Errorf("Copying between two remote locations is not supported: \"%s\"", source))
+				} else {
+					report(download(source, dest))
+				}
+			} else {
+				report(upload(source, dest))
+			}
+		}
+	}
+
+	err := pool.Quit()
 	if err != nil {
-		defer conn.Close()
-		return nil, nil, nil, fmt.Errorf("Error reading protocol banner: %s", err)
+		log.Print(err)
 	}
 
-	return conn, reader, writer, err
+	if failed > 0 {
+		log.Printf("%d of %d files failed", failed, copied+failed)
+		os.Exit(1)
+	}
 }
 
-func readResponse(reader *bufio.Reader, expected string) (response string, err error) {
-	response, err = reader.ReadString('\n')
+func upload(sourcefilename, destfilename string) error {
+	stat, err := os.Stat(sourcefilename)
 	if err != nil {
-		return "", err
+		return err
+	} else if stat.IsDir() && !recursive {
+		return fmt.Errorf("Omitting directory \"%s\", use -r to copy recursively", sourcefilename)
 	}
 
-	if strings.HasSuffix(response, MessageSuffix) {
-		response = response[:len(response)-len(MessageSuffix)]
+	desthost, destpath, err := parseRemote(destfilename)
+	if err != nil {
+		return err
 	}
 
-	if verbose {
-		log.Printf("Received response \"%s\"", response)
+	destpath, err = checkRemote(desthost, destpath, filepath.Base(sourcefilename), stat.IsDir())
+	if err != nil {
+		return err
 	}
 
-	if expected != "" && response != expected {
-		err = fmt.Errorf("Got \"%s\", expected \"%s\".", response, expected)
+	if stat.IsDir() {
+		return uploadDir(desthost, sourcefilename, destpath)
 	}
 
-	return response, err
+	return uploadFile(desthost, sourcefilename, destpath)
 }
 
-func sendCommand(writer *bufio.Writer, reader *bufio.Reader, command, expected string) (response string, err error) {
-	if verbose {
-		log.Printf("Sending command \"%s\"", command)
+// Resolve the remote destination path before uploading. The local filename
+// is appended if the destination is a directory, and the parent directory is
+// created if missing and -p is set.
+func checkRemote(desthost, destpath, name string, isDir bool) (string, error) {
+	destclient, err := pool.Client(desthost)
+	if err != nil {
+		return "", err
 	}
 
-	_, err = writer.WriteString(command + MessageSuffix)
+	stat, err := remoteStat(desthost, destclient, destpath)
 	if err != nil {
 		return "", err
 	}
 
-	err = writer.Flush()
+	if strings.HasSuffix(destpath, string(xbdm.PathSeparator)) || (stat != nil && stat.IsDir) {
+		if stat != nil && !stat.IsDir {
+			return "", fmt.Errorf("Destination %s:\"%s\" is not a directory", desthost, destpath)
+		}
+
+		destpath = xbdm.Join(destpath, name)
+
+		stat, err = remoteStat(desthost, destclient, destpath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if stat != nil {
+		if stat.IsDir && !isDir {
+			return "", fmt.Errorf("Destination %s:\"%s\" is a directory", desthost, destpath)
+		} else if !stat.IsDir && isDir {
+			return "", fmt.Errorf("Destination %s:\"%s\" is not a directory", desthost, destpath)
+		}
+
+		return destpath, nil
+	}
+
+	parent := xbdm.Dir(destpath)
+
+	if parents {
+		if verbose {
+			log.Printf("Creating remote directory \"%s\"", parent)
+		}
+
+		err = destclient.MkdirAll(parent)
+		if err != nil {
+			pool.Check(desthost, err)
+			return "", err
+		}
+
+		return destpath, nil
+	}
+
+	stat, err = remoteStat(desthost, destclient, parent)
 	if err != nil {
 		return "", err
+	} else if stat == nil {
+		return "", fmt.Errorf("Directory %s:\"%s\" is missing, use -p to create it", desthost, parent)
+	} else if stat != nil && !stat.IsDir {
+		return "", fmt.Errorf("Destination %s:\"%s\" is not a directory", desthost, parent)
+	}
+
+	return destpath, nil
+}
+
+// Stat a remote file, returning nil if it does not exist.
+func remoteStat(host string, c *xbdm.Client, path string) (*xbdm.FileInfo, error) {
+	stat, err := c.Stat(path)
+	if xbdm.IsStatus(err, xbdm.StatusFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		pool.Check(host, err)
+		return nil, err
+	}
+
+	return stat, nil
+}
+
+func uploadFile(desthost, sourcefilename, destpath string) error {
+	if noClobber {
+		destclient, err := pool.Client(desthost)
+		if err != nil {
+			return err
+		}
+
+		stat, err := remoteStat(desthost, destclient, destpath)
+		if err != nil {
+			return err
+		} else if stat != nil {
+			skip(sourcefilename, desthost+":"+destpath)
+			return nil
+		}
+	}
+
+	err := retry(func() error {
+		return sendFile(desthost, sourcefilename, destpath)
+	})
+
+	if err != nil {
+		return fmt.Errorf("Copying \"%s\" failed: %w", sourcefilename, err)
 	}
 
-	return readResponse(reader, expected)
+	copied++
+
+	return nil
 }
 
-func copyFile(sourcefilename, destfilename string) {
+func sendFile(desthost, sourcefilename, destpath string) error {
 	sourcefile, sourcelength, err := openLocal(sourcefilename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer sourcefile.Close()
 
-	desthost, destpath, err := parseRemote(destfilename, filepath.Base(sourcefilename))
+	destclient, err := pool.Client(desthost)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	transfer := startTransfer(sourcefilename, desthost+":"+destpath, 0, sourcelength)
+
+	err = destclient.SendFileProgress(destpath, sourcefile, sourcelength, transfer)
+	if err == nil && verify {
+		err = verifyRemote(destclient, destpath, sourcelength)
+	}
+
+	transfer.Finish(err)
+
+	// A size mismatch leaves the connection usable.
+	if err != nil && !errors.Is(err, errVerify) {
+		pool.Check(desthost, err)
 	}
 
-	destconn, destreader, destwriter, err := connect(desthost)
+	return err
+}
+
+func uploadDir(desthost, sourcedir, destpath string) error {
+	destclient, err := pool.Client(desthost)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer destconn.Close()
+	if verbose {
+		log.Printf("Creating remote directory \"%s\"", destpath)
+	}
 
-	command := fmt.Sprintf(CommandSendFile, destpath, sourcelength)
-	_, err = sendCommand(destwriter, destreader, command, ResponseSendBinary)
+	err = destclient.Mkdir(destpath)
+	if err != nil && !xbdm.IsStatus(err, xbdm.StatusAlreadyExists) {
+		pool.Check(desthost, err)
+		return err
+	}
+
+	entries, err := os.ReadDir(sourcedir)
 	if err != nil {
-		log.Fatalf("Command \"%s\" failed: %s", command, err)
+		return err
+	}
+
+	for _, entry := range entries {
+		sourcename := filepath.Join(sourcedir, entry.Name())
+		destname := xbdm.Join(destpath, entry.Name())
+
+		if entry.IsDir() {
+			report(uploadDir(desthost, sourcename, destname))
+		} else if entry.Type().IsRegular() {
+			report(uploadFile(desthost, sourcename, destname))
+		} else {
+			log.Printf("Skipping \"%s\": Not a regular file", sourcename)
+		}
+	}
+
+	return nil
+}
+
+func download(sourcefilename, destfilename string) error {
+	sourcehost, sourcepath, err := parseRemote(sourcefilename)
+	if err != nil {
+		return err
+	}
+
+	// Append remote filename if local path is a directory.
+	if stat, err := os.Stat(destfilename); (err == nil && stat.IsDir()) || strings.HasSuffix(destfilename, string(os.PathSeparator)) {
+		destfilename = filepath.Join(destfilename, xbdm.Base(sourcepath))
+	}
+
+	if recursive {
+		sourceclient, err := pool.Client(sourcehost)
+		if err != nil {
+			return err
+		}
+
+		stat, err := sourceclient.Stat(sourcepath)
+		if err != nil {
+			pool.Check(sourcehost, err)
+			return err
+		}
+
+		if stat.IsDir {
+			return downloadDir(sourcehost, sourcepath, destfilename)
+		}
+	}
+
+	return downloadFile(sourcehost, sourcepath, destfilename)
+}
+
+func downloadFile(sourcehost, sourcepath, destfilename string) error {
+	if noClobber {
+		if _, err := os.Lstat(destfilename); err == nil {
+			skip(sourcehost+":"+sourcepath, destfilename)
+			return nil
+		}
+	}
+
+	if parents {
+		err := os.MkdirAll(filepath.Dir(destfilename), 0777)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := retry(func() error {
+		return getFile(sourcehost, sourcepath, destfilename)
+	})
+
+	if err != nil {
+		return fmt.Errorf("Copying %s:\"%s\" failed: %w", sourcehost, sourcepath, err)
+	}
+
+	copied++
+
+	return nil
+}
+
+func getFile(sourcehost, sourcepath, destfilename string) error {
+	sourceclient, err := pool.Client(sourcehost)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+	// Continue from the end of a partial local file.
+	if resume {
+		if stat, err := os.Stat(destfilename); err == nil && stat.Mode().IsRegular() && stat.Size() > 0 {
+			remote, err := sourceclient.Stat(sourcepath)
+			if err != nil {
+				pool.Check(sourcehost, err)
+				return err
+			}
+
+			if stat.Size() <= remote.Size {
+				offset = stat.Size()
+				flags = os.O_WRONLY | os.O_APPEND
+
+				if verbose {
+					log.Printf("Resuming \"%s\" at %d of %d bytes", destfilename, offset, remote.Size)
+				}
+			}
+		}
+	}
+
+	source, length, err := sourceclient.OpenFileAt(sourcepath, offset, -1)
+	if err != nil {
+		pool.Check(sourcehost, err)
+		return err
 	}
 
 	if verbose {
-		log.Printf("Sending %d bytes of binary data", sourcelength)
+		log.Printf("Opening local file \"%s\"", destfilename)
+	}
+
+	destfile, err := os.OpenFile(destfilename, flags, 0666)
+	if err != nil {
+		// Drain the pending file data to keep the connection usable.
+		io.Copy(io.Discard, source)
+		return err
+	}
+
+	transfer := startTransfer(sourcehost+":"+sourcepath, destfilename, offset, offset+length)
+
+	n, err := io.Copy(io.MultiWriter(destfile, transfer), source)
+	if err == nil && n < length {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		pool.Check(sourcehost, err)
 	} else {
-		fmt.Printf("Copying \"%s\" (%d bytes) to %s:\"%s\"... ", sourcefilename, sourcelength, desthost, destpath)
+		err = destfile.Close()
 	}
 
-	_, err = io.Copy(destwriter, sourcefile)
+	transfer.Finish(err)
+
 	if err != nil {
-		log.Fatal("Copying file data failed: ", err)
+		destfile.Close()
+
+		// Keep partial files for resuming.
+		if !resume {
+			os.Remove(destfilename)
+		}
 	}
 
-	_, err = readResponse(destreader, ResponseOk)
+	return err
+}
+
+func downloadDir(sourcehost, sourcepath, destdir string) error {
+	sourceclient, err := pool.Client(sourcehost)
 	if err != nil {
-		log.Fatal("Copying file data failed: ", err)
-	} else if !verbose {
-		fmt.Println("Success")
+		return err
 	}
 
-	_, err = sendCommand(destwriter, destreader, CommandQuit, ResponseQuit)
+	if verbose {
+		log.Printf("Creating local directory \"%s\"", destdir)
+	}
+
+	if parents {
+		err = os.MkdirAll(destdir, 0777)
+	} else {
+		err = os.Mkdir(destdir, 0777)
+	}
+
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	files, err := sourceclient.DirList(sourcepath)
 	if err != nil {
-		log.Fatal("Farewell failed: ", err)
+		pool.Check(sourcehost, err)
+		return err
 	}
+
+	for _, file := range files {
+		sourcename := xbdm.Join(sourcepath, file.Name)
+		destname := filepath.Join(destdir, file.Name)
+
+		if file.IsDir {
+			report(downloadDir(sourcehost, sourcename, destname))
+		} else {
+			report(downloadFile(sourcehost, sourcename, destname))
+		}
+	}
+
+	return nil
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [-v] [sourcefile] [host:destfile]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [-n] [-p] [-r] [-sync [-delete]] [-verify] [-resume] [-retry N] [-progress MODE] [-interval DURATION] [-v] [sourcefile...] [destfile]\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
 func init() {
 	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&recursive, "r", false, "copy directories recursively")
+	flag.BoolVar(&noClobber, "n", false, "do not overwrite existing files")
+	flag.BoolVar(&parents, "p", false, "create missing parent directories")
+	flag.BoolVar(&syncMode, "sync", false, "only upload files that differ in size or modification time")
+	flag.BoolVar(&deleteExtra, "delete", false, "delete remote files missing locally when syncing")
+	flag.BoolVar(&verify, "verify", false, "verify remote file size after upload")
+	flag.BoolVar(&resume, "resume", false, "resume downloads from partial local files")
+	flag.IntVar(&retries, "retry", 0, "number of retries after network errors")
+	flag.Var(&progressMode, "progress", fmt.Sprintf("progress reporting, accepted values: %s", progressList()))
+	flag.DurationVar(&progressInterval, "interval", 500*time.Millisecond, "progress reporting interval")
 	flag.Usage = usage
 }
 
 func main() {
 	flag.Parse()
 
-	if flag.NArg() != 2 {
+	config = xbdm.UserConfig()
+
+	pool.Dialer = xbdm.NewDialer(verbose, config)
+
+	if flag.NArg() < 2 {
 		usage()
 	}
 
-	copyFile(flag.Args()[0], flag.Args()[1])
+	progressMode = progressMode.resolve()
+
+	args := flag.Args()
+	copyFiles(args[:len(args)-1], args[len(args)-1])
 }
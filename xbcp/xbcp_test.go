@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+// Start a fake console with empty C and E drives and a fresh connection pool.
+func newServer(t *testing.T) *xbdmtest.Server {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, drive := range []string{"C", "E"} {
+		err := os.Mkdir(filepath.Join(root, drive), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := xbdmtest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = xbdm.Pool{}
+
+	t.Cleanup(func() {
+		pool.Quit()
+		server.Close()
+	})
+
+	return server
+}
+
+// Reset the flags changed by the tests.
+func resetFlags() {
+	parents, noClobber, recursive, verify, resume = false, false, false, false, false
+	syncMode, deleteExtra = false, false
+	retries = 0
+	progressMode = Auto
+	copied, failed, unchanged = 0, 0, 0
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(name), 0777)
+	if err == nil {
+		err = os.WriteFile(name, []byte(data), 0666)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Announce length bytes of file data, but hang up after sending data.
+func shortFile(length int, data string) xbdmtest.Handler {
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		var prefix [4]byte
+		binary.LittleEndian.PutUint32(prefix[:], uint32(length))
+
+		c.Respond(xbdm.StatusBinary, "binary response follows")
+		c.Write(prefix[:])
+		c.Write([]byte(data))
+		c.Close()
+	}
+}
+
+// Accept an upload, but only store the first keep bytes of it, or all of it
+// if keep is negative.
+func storeSendFile(keep int) xbdmtest.Handler {
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		length, _ := cmd.Attrs.Uint("length")
+
+		c.Respond(xbdm.StatusSendBinary, "send binary data")
+
+		data, err := c.ReadBinary(int64(length))
+		if err != nil {
+			c.Close()
+			return
+		}
+
+		if keep >= 0 && keep < len(data) {
+			data = data[:keep]
+		}
+
+		path, err := c.Server.Path(cmd.Attrs["name"])
+		if err == nil {
+			err = os.WriteFile(path, data, 0666)
+		}
+
+		if err != nil {
+			c.RespondError(err)
+			return
+		}
+
+		c.Respond(xbdm.StatusOK, "OK")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	const data = "default.xbe contents"
+
+	tests := []struct {
+		name      string
+		setup     func(s *xbdmtest.Server)
+		dest      string
+		parents   bool
+		noClobber bool
+		verify    bool
+		want      string
+		content   string
+		status    xbdm.Status
+		err       error
+	}{
+		{name: "file", dest: `E:\default.xbe`, want: `E/default.xbe`},
+		{name: "drive root", dest: `E:\`, want: `E/src.xbe`},
+		{
+			name: "directory", dest: `E:\game`, want: `E/game/src.xbe`,
+			setup: func(s *xbdmtest.Server) { os.Mkdir(filepath.Join(s.Root, "E", "game"), 0777) },
+		},
+		{name: "missing parent", dest: `E:\game\default.xbe`},
+		{name: "create parents", dest: `E:\game\bin\default.xbe`, parents: true, want: `E/game/bin/default.xbe`},
+		{
+			name: "no clobber", dest: `E:\default.xbe`, noClobber: true, want: `E/default.xbe`, content: "old",
+			setup: func(s *xbdmtest.Server) { os.WriteFile(filepath.Join(s.Root, "E", "default.xbe"), []byte("old"), 0666) },
+		},
+		{name: "verify", dest: `E:\default.xbe`, verify: true, want: `E/default.xbe`},
+		{
+			name: "verify truncated", dest: `E:\default.xbe`, verify: true, err: errVerify,
+			setup: func(s *xbdmtest.Server) { s.Handle("sendfile", storeSendFile(len(data)/2)) },
+		},
+		{
+			name: "device full", dest: `E:\default.xbe`, status: xbdm.StatusDeviceFull,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("sendfile", xbdmtest.Respond(xbdm.StatusDeviceFull, "no room on device"))
+			},
+		},
+		{
+			name: "hangup", dest: `E:\default.xbe`,
+			setup: func(s *xbdmtest.Server) { s.Handle("sendfile", xbdmtest.Hangup()) },
+		},
+		{
+			name: "malformed banner", dest: `E:\default.xbe`,
+			setup: func(s *xbdmtest.Server) { s.SetBanner("hello") },
+		},
+		{
+			name: "malformed response", dest: `E:\default.xbe`,
+			setup: func(s *xbdmtest.Server) { s.Handle("getfileattributes", xbdmtest.Raw("2O2- OK\r\n")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			parents, noClobber, verify = tt.parents, tt.noClobber, tt.verify
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			source := filepath.Join(t.TempDir(), "src.xbe")
+			writeFile(t, source, data)
+
+			err := upload(source, server.Addr()+":"+tt.dest)
+
+			if tt.want == "" {
+				if err == nil {
+					t.Fatal("Upload succeeded, want error")
+				} else if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+					t.Errorf("Got %v, want status %s", err, tt.status)
+				} else if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("Got %v, want %v", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content := tt.content
+			if content == "" {
+				content = data
+			}
+
+			got, err := os.ReadFile(filepath.Join(server.Root, filepath.FromSlash(tt.want)))
+			if err != nil {
+				t.Fatal(err)
+			} else if string(got) != content {
+				t.Errorf("Uploaded %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+	const data = "saved game data"
+
+	tests := []struct {
+		name    string
+		setup   func(s *xbdmtest.Server)
+		partial string
+		resume  bool
+		want    string
+		status  xbdm.Status
+		err     bool
+	}{
+		{name: "file", want: data},
+		{name: "resume", partial: data[:5], resume: true, want: data},
+		{name: "resume complete", partial: data, resume: true, want: data},
+		{name: "overwrite", partial: "older and longer file", want: data},
+		{
+			name: "missing", status: xbdm.StatusFileNotFound,
+			setup: func(s *xbdmtest.Server) { os.Remove(filepath.Join(s.Root, "E", "save.xbx")) },
+		},
+		{
+			name: "access denied", status: xbdm.StatusAccessDenied,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("getfile", xbdmtest.Respond(xbdm.StatusAccessDenied, "access denied"))
+			},
+		},
+		{
+			name: "short payload", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("getfile", shortFile(len(data), data[:4])) },
+		},
+		{
+			// The partial file is kept for resuming.
+			name: "short payload resume", resume: true, want: data[:4], err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("getfile", shortFile(len(data), data[:4])) },
+		},
+		{
+			name: "short length", err: true,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("getfile", func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+					xbdmtest.Raw("203- binary response follows\r\n\x10\x00")(c, cmd)
+					c.Close()
+				})
+			},
+		},
+		{
+			name: "hangup", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("getfile", xbdmtest.Hangup()) },
+		},
+		{
+			name: "malformed response", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("getfile", xbdmtest.Raw("203 binary response follows\r\n")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			resume = tt.resume
+
+			server := newServer(t)
+			writeFile(t, filepath.Join(server.Root, "E", "save.xbx"), data)
+
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			dest := filepath.Join(t.TempDir(), "save.xbx")
+			if tt.partial != "" {
+				writeFile(t, dest, tt.partial)
+			}
+
+			err := download(server.Addr()+`:E:\save.xbx`, dest)
+
+			if tt.err || tt.status != 0 {
+				if err == nil {
+					t.Error("Download succeeded, want error")
+				} else if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+					t.Errorf("Got %v, want status %s", err, tt.status)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dest)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Left %q behind after failing", got)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if string(got) != tt.want {
+				t.Errorf("Downloaded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	resetFlags()
+	recursive = true
+
+	server := newServer(t)
+
+	source := filepath.Join(t.TempDir(), "game")
+	files := map[string]string{
+		"default.xbe":       "executable",
+		"media/title.xpr":   "textures",
+		"media/sfx/hit.wav": "sound",
+	}
+
+	for name, data := range files {
+		writeFile(t, filepath.Join(source, filepath.FromSlash(name)), data)
+	}
+
+	err := upload(source, server.Addr()+`:E:\`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "copy")
+
+	err = download(server.Addr()+`:E:\game`, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		for _, dir := range []string{filepath.Join(server.Root, "E", "game"), dest} {
+			got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Error(err)
+			} else if string(got) != data {
+				t.Errorf("%s: Copied %q, want %q", name, got, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+var (
+	verbose    bool
+	jsonOutput bool
+	timeout    time.Duration
+	address    string
+)
+
+func printConsoles(consoles []xbdm.Console) {
+	sort.Slice(consoles, func(i, j int) bool {
+		return strings.ToLower(consoles[i].Name) < strings.ToLower(consoles[j].Name)
+	})
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(consoles, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(data))
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	for _, c := range consoles {
+		fmt.Fprintf(tw, "%s\t%s\n", c.Name, c.IP)
+	}
+
+	tw.Flush()
+}
+
+func discover(names []string) {
+	resolver := xbdm.Resolver{Address: address, Timeout: timeout}
+
+	if verbose {
+		log.Printf("Querying %s for %s", resolver.Address, timeout)
+	}
+
+	if len(names) == 0 {
+		consoles, err := resolver.Discover(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if verbose {
+			log.Printf("Found %d consoles", len(consoles))
+		}
+
+		printConsoles(consoles)
+
+		if len(consoles) == 0 {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	var consoles []xbdm.Console
+	failed := 0
+
+	for _, name := range names {
+		console, err := resolver.Lookup(context.Background(), name)
+		if err != nil {
+			failed++
+			log.Print(err)
+			continue
+		}
+
+		consoles = append(consoles, *console)
+	}
+
+	printConsoles(consoles)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-t timeout] [-a address] [-json] [-v] [name...]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func init() {
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&jsonOutput, "json", false, "JSON output")
+	flag.DurationVar(&timeout, "t", xbdm.DefaultResolveTimeout, "time to wait for replies")
+	flag.StringVar(&address, "a", fmt.Sprintf("255.255.255.255:%d", xbdm.Port), "address to send queries to")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+
+	discover(flag.Args())
+}
@@ -0,0 +1,157 @@
+package xbdm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attributes holds the key=value pairs of a response line. Keys are stored
+// in lower case. Flags without a value are stored with an empty value.
+type Attributes map[string]string
+
+// Offset between the FILETIME epoch (1601-01-01) and the Unix epoch in 100
+// nanosecond intervals.
+const fileTimeEpoch = 116444736000000000
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == ',' || c == '\t'
+}
+
+// ParseAttributes parses a line on the format
+// `key=value key=0x1234 key="quoted string" flag`.
+func ParseAttributes(line string) (Attributes, error) {
+	attrs := Attributes{}
+
+	for i := 0; i < len(line); {
+		// Skip separators.
+		if isSeparator(line[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && !isSeparator(line[i]) {
+			i++
+		}
+
+		key := strings.ToLower(line[start:i])
+
+		if i >= len(line) || line[i] != '=' {
+			attrs[key] = ""
+			continue
+		}
+
+		i++
+
+		if i < len(line) && line[i] == '"' {
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated quoted value for \"%s\" in \"%s\"", key, line)
+			}
+
+			attrs[key] = line[i+1 : i+1+end]
+			i += end + 2
+			continue
+		}
+
+		start = i
+		for i < len(line) && !isSeparator(line[i]) {
+			i++
+		}
+
+		attrs[key] = line[start:i]
+	}
+
+	return attrs, nil
+}
+
+// Has reports whether key is present, with or without a value.
+func (a Attributes) Has(key string) bool {
+	_, ok := a[key]
+	return ok
+}
+
+// String returns the value of key.
+func (a Attributes) String(key string) (string, error) {
+	value, ok := a[key]
+	if !ok {
+		return "", fmt.Errorf("Missing attribute \"%s\"", key)
+	}
+
+	return value, nil
+}
+
+// Uint returns the value of key as an unsigned integer. Values prefixed with
+// 0x are parsed as hexadecimal.
+func (a Attributes) Uint(key string) (uint64, error) {
+	value, err := a.String(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		n, err = strconv.ParseUint(value[2:], 16, 64)
+	} else {
+		n, err = strconv.ParseUint(value, 10, 64)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid integer attribute %s=%s", key, value)
+	}
+
+	return n, nil
+}
+
+// Int returns the value of key as an int.
+func (a Attributes) Int(key string) (int, error) {
+	n, err := a.Uint(key)
+	return int(n), err
+}
+
+// Uint64 combines the 32 bit attributes hi and lo into a 64 bit value.
+func (a Attributes) Uint64(hi, lo string) (uint64, error) {
+	h, err := a.Uint(hi)
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := a.Uint(lo)
+	if err != nil {
+		return 0, err
+	}
+
+	return h<<32 | l&0xffffffff, nil
+}
+
+// Time decodes the FILETIME stored in the attributes hi and lo.
+func (a Attributes) Time(hi, lo string) (time.Time, error) {
+	ft, err := a.Uint64(hi, lo)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return FileTime(ft), nil
+}
+
+// FileTime converts a FILETIME, the number of 100 nanosecond intervals since
+// 1601-01-01 UTC, to time.Time.
+func FileTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+
+	ns := (int64(ft) - fileTimeEpoch) * 100
+	return time.Unix(0, ns).UTC()
+}
+
+// ToFileTime converts t to a FILETIME.
+func ToFileTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return uint64(t.UnixNano()/100 + fileTimeEpoch)
+}
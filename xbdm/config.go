@@ -0,0 +1,183 @@
+package xbdm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Consoles are given friendly names in a config file in the user's config
+// directory, one per line with an optional default partition:
+//
+//	# name  host[:port]       [partition]
+//	kit3    192.168.1.30      E:\
+//	kit4    10.0.0.4:731      F:\games\
+//
+// The console used when no host is given is read from the environment.
+const (
+	ConfigFile = "dutils/consoles"
+	ConsoleEnv = "XBDM_CONSOLE"
+)
+
+var ErrNoConsole = errors.New("No console given and " + ConsoleEnv + " not set")
+
+var partitionPattern = regexp.MustCompile(`^[A-Za-z]:`)
+
+// ConsoleConfig is a named console in the config file.
+type ConsoleConfig struct {
+	Name      string
+	Host      string
+	Partition string
+}
+
+// Config holds the named consoles and the default console. The methods treat
+// a nil config as empty.
+type Config struct {
+	// Consoles maps lower case console names to their entries.
+	Consoles map[string]ConsoleConfig
+
+	// Default is the console used when no host is given.
+	Default string
+}
+
+// ConfigPath returns the location of the user's console config file.
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(ConfigFile)), nil
+}
+
+// ReadConfig parses the console config file name.
+func ReadConfig(name string) (*Config, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	config := &Config{Consoles: map[string]ConsoleConfig{}}
+
+	scanner := bufio.NewScanner(file)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: Expected \"name host[:port] [partition]\"", name, n)
+		}
+
+		console := ConsoleConfig{Name: fields[0]}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: Missing host for console \"%s\"", name, n, console.Name)
+		}
+
+		console.Host = fields[1]
+
+		if len(fields) == 3 {
+			console.Partition = fields[2]
+
+			if !partitionPattern.MatchString(console.Partition) {
+				return nil, fmt.Errorf("%s:%d: Partition must be on the format \"X:\\path\", got \"%s\"", name, n, console.Partition)
+			}
+
+			if !strings.HasSuffix(console.Partition, "\\") {
+				console.Partition += "\\"
+			}
+		}
+
+		key := strings.ToLower(console.Name)
+
+		if _, ok := config.Consoles[key]; ok {
+			return nil, fmt.Errorf("%s:%d: Duplicate console \"%s\"", name, n, console.Name)
+		}
+
+		config.Consoles[key] = console
+	}
+
+	return config, scanner.Err()
+}
+
+// LoadConfig reads the user's console config file and the default console
+// from the environment. A missing file is not an error, and the returned
+// config is usable even if the file is malformed.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+
+	name, err := ConfigPath()
+	if err == nil {
+		var file *Config
+
+		file, err = ReadConfig(name)
+		if file != nil {
+			config = file
+		}
+	}
+
+	// No config directory or file means no named consoles.
+	if errors.Is(err, os.ErrNotExist) || name == "" {
+		err = nil
+	}
+
+	config.Default = os.Getenv(ConsoleEnv)
+
+	return config, err
+}
+
+// UserConfig is LoadConfig for the command line tools. Console names are a
+// convenience, so a malformed config file is only logged.
+func UserConfig() *Config {
+	config, err := LoadConfig()
+	if err != nil {
+		log.Print(err)
+	}
+
+	return config
+}
+
+// Console returns the entry named name, compared case insensitively.
+func (c *Config) Console(name string) (ConsoleConfig, bool) {
+	if c == nil {
+		return ConsoleConfig{}, false
+	}
+
+	console, ok := c.Consoles[strings.ToLower(name)]
+	return console, ok
+}
+
+// Resolve returns the host of the console named host, or host unchanged if
+// it isn't a configured name.
+func (c *Config) Resolve(host string) string {
+	if console, ok := c.Console(host); ok {
+		return console.Host
+	}
+
+	return host
+}
+
+// DefaultConsole returns the console used when no host is given, or an empty
+// string if not set.
+func (c *Config) DefaultConsole() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.Default
+}
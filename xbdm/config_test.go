@@ -0,0 +1,150 @@
+package xbdm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `# name  host[:port]   [partition]
+kit3    192.168.1.30  E:\
+Kit4    10.0.0.4:731  F:\games   # trailing comment
+
+devkit  devkit.lan
+`
+
+func writeConfig(t *testing.T, name, data string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(name), 0777)
+	if err == nil {
+		err = os.WriteFile(name, []byte(data), 0666)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Point the user's config directory to a temporary directory on all
+// platforms and set the default console. The console config file in it is
+// written unless data is empty.
+func setUserConfig(t *testing.T, data, console string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	t.Setenv(ConsoleEnv, console)
+
+	if data == "" {
+		return
+	}
+
+	name, err := ConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, name, data)
+}
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]ConsoleConfig
+		err   bool
+	}{
+		{
+			name:  "consoles",
+			input: testConfig,
+			want: map[string]ConsoleConfig{
+				"kit3":   {Name: "kit3", Host: "192.168.1.30", Partition: `E:\`},
+				"kit4":   {Name: "Kit4", Host: "10.0.0.4:731", Partition: `F:\games\`},
+				"devkit": {Name: "devkit", Host: "devkit.lan"},
+			},
+		},
+		{name: "empty", input: "\n# no consoles\n\n", want: map[string]ConsoleConfig{}},
+		{name: "too many fields", input: "kit3 192.168.1.30 E:\\ extra\n", err: true},
+		{name: "missing host", input: "kit3\n", err: true},
+		{name: "relative partition", input: "kit3 192.168.1.30 games\n", err: true},
+		{name: "partition without drive", input: "kit3 192.168.1.30 \\games\n", err: true},
+		{name: "duplicate", input: "kit3 192.168.1.30\nKIT3 192.168.1.31\n", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "consoles")
+			writeConfig(t, name, tt.input)
+
+			config, err := ReadConfig(name)
+
+			if tt.err {
+				if err == nil {
+					t.Errorf("Read %+v, want error", config.Consoles)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(config.Consoles, tt.want) {
+				t.Errorf("Read %+v, want %+v", config.Consoles, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setUserConfig(t, testConfig, "kit3")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DefaultConsole() != "kit3" {
+		t.Errorf("Default console \"%s\", want \"kit3\"", config.DefaultConsole())
+	}
+
+	if host := config.Resolve("KIT4"); host != "10.0.0.4:731" {
+		t.Errorf("Resolved KIT4 to \"%s\", want \"10.0.0.4:731\"", host)
+	}
+
+	if host := config.Resolve("10.0.0.5"); host != "10.0.0.5" {
+		t.Errorf("Resolved 10.0.0.5 to \"%s\", want it unchanged", host)
+	}
+}
+
+func TestLoadConfigMalformed(t *testing.T) {
+	setUserConfig(t, "kit3\n", "10.0.0.5")
+
+	// The error is reported, but the default console is still set.
+	config, err := LoadConfig()
+	if err == nil {
+		t.Error("Loaded malformed config")
+	} else if config.DefaultConsole() != "10.0.0.5" {
+		t.Errorf("Default console \"%s\", want \"10.0.0.5\"", config.DefaultConsole())
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	setUserConfig(t, "", "")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(config.Consoles) != 0 || config.DefaultConsole() != "" {
+		t.Errorf("Loaded %+v from missing file", config)
+	}
+
+	_, err = ReadConfig(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Got %v, want %v", err, os.ErrNotExist)
+	}
+}
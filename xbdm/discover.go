@@ -0,0 +1,178 @@
+package xbdm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name answering protocol packets are a type byte, a name length byte and
+// the name, sent over UDP to the debug monitor port.
+const (
+	NameLookup   = 1
+	NameReply    = 2
+	NameWildcard = 3
+
+	MaxNameLength         = 255
+	DefaultResolveTimeout = time.Second
+)
+
+var ErrConsoleNotFound = errors.New("Console not found")
+
+// Console is a debug monitor answering a name query.
+type Console struct {
+	Name string `json:"name"`
+	IP   net.IP `json:"ip"`
+}
+
+// Resolver finds consoles by the name answering protocol.
+type Resolver struct {
+	// Address is where queries are sent. The broadcast address on Port is
+	// used if empty.
+	Address string
+
+	// Timeout is the time spent collecting replies. DefaultResolveTimeout is
+	// used if zero.
+	Timeout time.Duration
+}
+
+// ParseNamePacket returns the type and name of a name answering protocol
+// packet.
+func ParseNamePacket(p []byte) (byte, string, error) {
+	if len(p) < 2 || len(p) < 2+int(p[1]) {
+		return 0, "", fmt.Errorf("Short name packet of %d bytes", len(p))
+	}
+
+	return p[0], string(p[2 : 2+int(p[1])]), nil
+}
+
+// NamePacket encodes a name answering protocol packet.
+func NamePacket(kind byte, name string) ([]byte, error) {
+	if len(name) > MaxNameLength {
+		return nil, fmt.Errorf("Console name too long: \"%s\"", name)
+	}
+
+	return append([]byte{kind, byte(len(name))}, name...), nil
+}
+
+// Send a query and call found for every reply until the timeout expires or
+// found returns false.
+func (r *Resolver) query(ctx context.Context, kind byte, name string, found func(c Console) bool) error {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultResolveTimeout
+	}
+
+	address := r.Address
+	if address == "" {
+		address = net.JoinHostPort(net.IPv4bcast.String(), strconv.Itoa(Port))
+	}
+
+	dest, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	packet, err := NamePacket(kind, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteTo(packet, dest)
+	if err != nil {
+		return fmt.Errorf("Error sending name query: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2+MaxNameLength)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		kind, name, err := ParseNamePacket(buf[:n])
+		if err != nil || kind != NameReply {
+			continue
+		}
+
+		if !found(Console{Name: name, IP: from.IP}) {
+			return nil
+		}
+	}
+}
+
+// Discover returns every console answering a wildcard query.
+func (r *Resolver) Discover(ctx context.Context) ([]Console, error) {
+	var consoles []Console
+
+	seen := map[string]bool{}
+
+	err := r.query(ctx, NameWildcard, "", func(c Console) bool {
+		if !seen[c.IP.String()] {
+			seen[c.IP.String()] = true
+			consoles = append(consoles, c)
+		}
+
+		return true
+	})
+
+	return consoles, err
+}
+
+// Lookup returns the console with the given name, compared case
+// insensitively.
+func (r *Resolver) Lookup(ctx context.Context, name string) (*Console, error) {
+	var console *Console
+
+	err := r.query(ctx, NameLookup, name, func(c Console) bool {
+		if strings.EqualFold(c.Name, name) {
+			console = &c
+			return false
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	} else if console == nil {
+		return nil, fmt.Errorf("%w: \"%s\"", ErrConsoleNotFound, name)
+	}
+
+	return console, nil
+}
+
+// Discover returns every console on the local network answering within
+// timeout.
+func Discover(timeout time.Duration) ([]Console, error) {
+	r := Resolver{Timeout: timeout}
+	return r.Discover(context.Background())
+}
+
+// Lookup finds the console with the given name on the local network.
+func Lookup(name string) (*Console, error) {
+	r := Resolver{}
+	return r.Lookup(context.Background(), name)
+}
@@ -0,0 +1,210 @@
+package xbdm_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+const testTimeout = 200 * time.Millisecond
+
+func newResponder(t *testing.T, name string) *xbdmtest.Responder {
+	t.Helper()
+
+	r, err := xbdmtest.NewResponder(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+// Answer every query with the given packets verbatim, for malformed replies.
+func replyWith(t *testing.T, packets ...[]byte) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2+xbdm.MaxNameLength)
+
+		for {
+			_, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			for _, p := range packets {
+				conn.WriteToUDP(p, from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func namePacket(t *testing.T, kind byte, name string) []byte {
+	t.Helper()
+
+	p, err := xbdm.NamePacket(kind, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		packets [][]byte
+		want    string
+	}{
+		{name: "exact", query: "Kit3", want: "Kit3"},
+		{name: "case insensitive", query: "kIT3", want: "Kit3"},
+		{name: "not found", query: "Kit4"},
+		{name: "empty packet", query: "Kit3", packets: [][]byte{{}}},
+		{name: "short packet", query: "Kit3", packets: [][]byte{{xbdm.NameReply, 4, 'K', 'i'}}},
+		{name: "not a reply", query: "Kit3", packets: [][]byte{{xbdm.NameLookup, 4, 'K', 'i', 't', '3'}}},
+		{name: "other console", query: "Kit3", packets: [][]byte{{xbdm.NameReply, 4, 'K', 'i', 't', '4'}}},
+		{
+			name: "malformed before reply", query: "kit3", want: "Kit3",
+			packets: [][]byte{{xbdm.NameReply, 9, 'K'}, {xbdm.NameReply, 4, 'K', 'i', 't', '3'}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var address string
+
+			if tt.packets == nil {
+				address = newResponder(t, "Kit3").Addr()
+			} else {
+				address = replyWith(t, tt.packets...)
+			}
+
+			r := xbdm.Resolver{Address: address, Timeout: testTimeout}
+
+			console, err := r.Lookup(context.Background(), tt.query)
+
+			if tt.want == "" {
+				if !errors.Is(err, xbdm.ErrConsoleNotFound) {
+					t.Errorf("Lookup(%q) = %v, %v, want %v", tt.query, console, err, xbdm.ErrConsoleNotFound)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Lookup(%q) failed: %v", tt.query, err)
+			}
+
+			if console.Name != tt.want || !console.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("Lookup(%q) = %s at %s, want %s at 127.0.0.1", tt.query, console.Name, console.IP, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    []string
+	}{
+		{name: "responder", want: []string{"Kit3"}},
+		{name: "none", packets: [][]byte{}},
+		{name: "malformed", packets: [][]byte{{xbdm.NameReply}, {xbdm.NameWildcard, 0}}},
+		{
+			// Consoles are told apart by address, so repeated replies are
+			// only listed once.
+			name:    "repeated",
+			packets: [][]byte{{xbdm.NameReply, 1}, {xbdm.NameReply, 2, 'A', 'B'}, {xbdm.NameReply, 2, 'A', 'B'}},
+			want:    []string{"AB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var address string
+
+			if tt.packets == nil {
+				address = newResponder(t, "Kit3").Addr()
+			} else {
+				address = replyWith(t, tt.packets...)
+			}
+
+			r := xbdm.Resolver{Address: address, Timeout: testTimeout}
+
+			consoles, err := r.Discover(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(consoles) != len(tt.want) {
+				t.Fatalf("Discover() = %v, want %q", consoles, tt.want)
+			}
+
+			for i, c := range consoles {
+				if c.Name != tt.want[i] {
+					t.Errorf("Console %d is %s, want %s", i, c.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDialName(t *testing.T) {
+	server, err := xbdmtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The .invalid domain is never found by DNS.
+	responder := newResponder(t, "devkit.invalid")
+	d := xbdm.Dialer{Resolver: &xbdm.Resolver{Address: responder.Addr(), Timeout: testTimeout}}
+
+	client, err := d.Dial(net.JoinHostPort("DevKit.invalid", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Quit()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = d.Dial(net.JoinHostPort("other.invalid", port))
+	if !errors.Is(err, xbdm.ErrConsoleNotFound) {
+		t.Errorf("Dialing unknown name: %v, want %v", err, xbdm.ErrConsoleNotFound)
+	}
+
+	responder.SetName("other.invalid")
+
+	client, err = d.Dial(net.JoinHostPort("other.invalid", port))
+	if err != nil {
+		t.Fatalf("Dialing renamed console: %v", err)
+	}
+
+	client.Quit()
+}
@@ -0,0 +1,119 @@
+package xbdm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	DefaultWorkers = 8
+)
+
+// Result is the outcome of running a function against one console.
+type Result struct {
+	Host     string
+	Err      error
+	Duration time.Duration
+}
+
+// FanOut calls fn for every host concurrently, running at most workers at a
+// time. Results are returned in the order of hosts.
+func FanOut(hosts []string, workers int, fn func(host string) error) []Result {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+
+	results := make([]Result, len(hosts))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < len(hosts); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				start := time.Now()
+				err := fn(hosts[i])
+				results[i] = Result{Host: hosts[i], Err: err, Duration: time.Since(start)}
+			}
+		}()
+	}
+
+	for i := range hosts {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Failed returns the number of results with an error.
+func Failed(results []Result) int {
+	failed := 0
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// WriteResults prints a table with the status of every host.
+func WriteResults(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "HOST\tSTATUS\tTIME\tERROR")
+
+	for _, r := range results {
+		status, message := "OK", ""
+		if r.Err != nil {
+			status, message = "FAILED", r.Err.Error()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Host, status, r.Duration.Round(time.Millisecond), message)
+	}
+
+	return tw.Flush()
+}
+
+// ReadHosts reads a file listing one host per line. Blank lines and comments
+// starting with # are ignored.
+func ReadHosts(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var hosts []string
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			hosts = append(hosts, line)
+		}
+	}
+
+	return hosts, scanner.Err()
+}
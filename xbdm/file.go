@@ -0,0 +1,358 @@
+package xbdm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// FileInfo describes a file as reported by dirlist and getfileattributes.
+type FileInfo struct {
+	Name    string
+	Size    int64
+	Created time.Time
+	Changed time.Time
+	IsDir   bool
+}
+
+func parseFileInfo(attrs Attributes) (*FileInfo, error) {
+	size, err := attrs.Uint64("sizehi", "sizelo")
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &FileInfo{
+		Name:  attrs["name"],
+		Size:  int64(size),
+		IsDir: attrs.Has("directory"),
+	}
+
+	// Timestamps are optional.
+	fi.Created, _ = attrs.Time("createhi", "createlo")
+	fi.Changed, _ = attrs.Time("changehi", "changelo")
+
+	return fi, nil
+}
+
+// Base returns the last element of the console path name.
+func Base(name string) string {
+	name = strings.TrimRight(name, string(PathSeparator))
+
+	if i := strings.LastIndexByte(name, PathSeparator); i >= 0 {
+		return name[i+1:]
+	}
+
+	if len(name) == 2 && name[1] == ':' {
+		return ""
+	}
+
+	return name
+}
+
+// Dir returns all but the last element of the console path name, keeping the
+// trailing separator of drive roots.
+func Dir(name string) string {
+	name = strings.TrimRight(name, string(PathSeparator))
+
+	i := strings.LastIndexByte(name, PathSeparator)
+	if i < 0 {
+		return name
+	}
+
+	if i == 2 && name[1] == ':' {
+		return name[:3]
+	}
+
+	return name[:i]
+}
+
+// IsRoot reports whether the console path name is a drive root like "E:\".
+func IsRoot(name string) bool {
+	name = strings.TrimRight(name, string(PathSeparator))
+
+	return len(name) == 2 && name[1] == ':'
+}
+
+// Join joins a console directory and a file name.
+func Join(dir, name string) string {
+	if dir == "" || strings.HasSuffix(dir, string(PathSeparator)) {
+		return dir + name
+	}
+
+	return dir + string(PathSeparator) + name
+}
+
+// FormatSize returns n bytes in human readable binary units, e.g. "1.5 KiB".
+func FormatSize(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// SendFile writes length bytes from r to the file name on the console.
+func (c *Client) SendFile(name string, r io.Reader, length int64) error {
+	return c.SendFileProgress(name, r, length, nil)
+}
+
+// SendFileProgress is like SendFile, but also writes the data to progress as
+// it is written to the connection, e.g. to count the bytes sent.
+func (c *Client) SendFileProgress(name string, r io.Reader, length int64, progress io.Writer) error {
+	command := fmt.Sprintf("sendfile name=\"%s\" length=0x%x", name, length)
+
+	_, err := c.Command(command, StatusSendBinary)
+	if err != nil {
+		return err
+	}
+
+	c.logf("Sending %d bytes of binary data", length)
+
+	// The command is flushed, so the data bypasses the buffered writer.
+	var w io.Writer = c.conn
+	if progress != nil {
+		w = io.MultiWriter(c.conn, progress)
+	}
+
+	_, err = io.CopyN(w, r, length)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ReadResponse(StatusOK)
+	return err
+}
+
+// OpenFile requests the file name on the console and returns a reader for
+// its contents along with its length. The reader must be drained before the
+// next command is sent.
+func (c *Client) OpenFile(name string) (io.Reader, int64, error) {
+	return c.OpenFileAt(name, 0, -1)
+}
+
+// OpenFileAt is like OpenFile, but only returns size bytes starting at
+// offset. A negative size reads to the end of the file.
+func (c *Client) OpenFileAt(name string, offset, size int64) (io.Reader, int64, error) {
+	command := fmt.Sprintf("getfile name=\"%s\"", name)
+
+	if offset > 0 || size >= 0 {
+		if size < 0 {
+			size = 0xffffffff
+		}
+
+		command += fmt.Sprintf(" offset=0x%x size=0x%x", offset, size)
+	}
+
+	_, err := c.Command(command, StatusBinary)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	length, err := c.ReadLength()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return io.LimitReader(c.reader, length), length, nil
+}
+
+// GetFile writes the contents of the file name on the console to w and
+// returns the number of bytes copied.
+func (c *Client) GetFile(name string, w io.Writer) (int64, error) {
+	r, length, err := c.OpenFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(w, r)
+	if err == nil && n < length {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return n, fmt.Errorf("Error receiving file data: %w", err)
+	}
+
+	return n, nil
+}
+
+// DriveList returns the letters of the drives available on the console.
+func (c *Client) DriveList() ([]string, error) {
+	resp, err := c.Command("drivelist", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var drives []string
+
+	switch resp.Status {
+	case StatusOK:
+		for _, r := range resp.Message {
+			if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+				drives = append(drives, string(r))
+			}
+		}
+	case StatusMultiline:
+		list, err := resp.LineAttributes()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attrs := range list {
+			if drive := attrs["drivename"]; drive != "" {
+				drives = append(drives, drive)
+			}
+		}
+	default:
+		return nil, &Error{Command: "drivelist", Status: resp.Status, Message: resp.Message, Expected: StatusOK}
+	}
+
+	return drives, nil
+}
+
+// Stat returns the attributes of the file name on the console. Drive roots
+// have no attributes and are reported as directories without asking.
+func (c *Client) Stat(name string) (*FileInfo, error) {
+	if IsRoot(name) {
+		return &FileInfo{IsDir: true}, nil
+	}
+
+	list, err := c.CommandAttributes(fmt.Sprintf("getfileattributes name=\"%s\"", name))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("Empty attribute list for \"%s\"", name)
+	}
+
+	fi, err := parseFileInfo(list[0])
+	if err != nil {
+		return nil, err
+	}
+
+	fi.Name = Base(name)
+
+	return fi, nil
+}
+
+// DirList returns the contents of the directory dir on the console.
+func (c *Client) DirList(dir string) ([]*FileInfo, error) {
+	list, err := c.CommandAttributes(fmt.Sprintf("dirlist name=\"%s\"", dir))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*FileInfo, 0, len(list))
+
+	for _, attrs := range list {
+		fi, err := parseFileInfo(attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, fi)
+	}
+
+	return files, nil
+}
+
+// Mkdir creates the directory name on the console.
+func (c *Client) Mkdir(name string) error {
+	_, err := c.Command(fmt.Sprintf("mkdir name=\"%s\"", name), StatusOK)
+	return err
+}
+
+// MkdirAll creates the directory name on the console along with any missing
+// parents.
+func (c *Client) MkdirAll(name string) error {
+	stat, err := c.Stat(name)
+	if err == nil {
+		if !stat.IsDir {
+			return fmt.Errorf("Not a directory: \"%s\"", name)
+		}
+
+		return nil
+	} else if !IsStatus(err, StatusFileNotFound) {
+		return err
+	}
+
+	if parent := Dir(name); !IsRoot(parent) {
+		err = c.MkdirAll(parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mkdir(name)
+	if IsStatus(err, StatusAlreadyExists) {
+		return nil
+	}
+
+	return err
+}
+
+// Delete removes the file or empty directory name on the console.
+func (c *Client) Delete(name string, isDir bool) error {
+	command := fmt.Sprintf("delete name=\"%s\"", name)
+
+	if isDir {
+		command += " dir"
+	}
+
+	_, err := c.Command(command, StatusOK)
+	return err
+}
+
+// Rename moves the file or directory name on the console to newname.
+func (c *Client) Rename(name, newname string) error {
+	_, err := c.Command(fmt.Sprintf("rename name=\"%s\" newname=\"%s\"", name, newname), StatusOK)
+	return err
+}
+
+// RemoveAll removes the file or directory name on the console along with
+// everything it contains.
+func (c *Client) RemoveAll(name string) error {
+	stat, err := c.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if stat.IsDir {
+		files, err := c.DirList(name)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			err = c.RemoveAll(Join(name, file.Name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.Delete(name, stat.IsDir)
+}
+
+// SetFileTime sets the creation and modification times of the file name on
+// the console.
+func (c *Client) SetFileTime(name string, created, changed time.Time) error {
+	create := ToFileTime(created)
+	change := ToFileTime(changed)
+
+	command := fmt.Sprintf("setfileattributes name=\"%s\" createhi=0x%08x createlo=0x%08x changehi=0x%08x changelo=0x%08x",
+		name, create>>32, create&0xffffffff, change>>32, change&0xffffffff)
+
+	_, err := c.Command(command, StatusOK)
+	return err
+}
@@ -0,0 +1,25 @@
+package xbdm
+
+import "testing"
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1024, want: "1.0 KiB"},
+		{size: 1536, want: "1.5 KiB"},
+		{size: 1024 * 1024, want: "1.0 MiB"},
+		{size: 8 << 30, want: "8.0 GiB"},
+		{size: 3 << 40, want: "3.0 TiB"},
+		{size: 1 << 62, want: "4.0 EiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatSize(tt.size); got != tt.want {
+			t.Errorf("FormatSize(%d) = \"%s\", want \"%s\"", tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package xbdm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	CommandNotify    = "notify"
+	CommandExecState = "getexecstate"
+
+	ExecStateStarted   = "started"
+	ExecStateStopped   = "stopped"
+	ExecStatePending   = "pending"
+	ExecStateRebooting = "rebooting"
+
+	NotificationExecutionStarted   = "execution " + ExecStateStarted
+	NotificationExecutionStopped   = "execution " + ExecStateStopped
+	NotificationExecutionPending   = "execution " + ExecStatePending
+	NotificationExecutionRebooting = "execution " + ExecStateRebooting
+)
+
+// Notify turns the connection into a notification channel. No further
+// commands can be sent, use ReadNotification to receive events.
+func (c *Client) Notify() error {
+	_, err := c.Command(CommandNotify, StatusNotification)
+	return err
+}
+
+// ReadNotification reads the next event from a notification channel.
+func (c *Client) ReadNotification() (string, error) {
+	line, err := c.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	c.logf("Received notification \"%s\"", line)
+
+	return line, nil
+}
+
+// ExecState returns the current execution state of the console, such as
+// ExecStateStarted. Events before a notification channel was opened are not
+// repeated on it, so ask for the state after opening one to not miss them.
+func (c *Client) ExecState() (string, error) {
+	resp, err := c.Command(CommandExecState, StatusOK)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Message, nil
+}
+
+// DialWait connects to the debug monitor on host, retrying every interval
+// until it answers or ctx is done. The error of the last attempt is returned
+// on failure.
+func (d *Dialer) DialWait(ctx context.Context, host string, interval time.Duration) (*Client, error) {
+	for {
+		c, err := d.DialContext(ctx, host)
+		if err == nil {
+			return c, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Debug monitor on %s not answering: %w", Address(host), err)
+		case <-time.After(interval):
+		}
+	}
+}
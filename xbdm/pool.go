@@ -0,0 +1,91 @@
+package xbdm
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// NewDialer returns a dialer with the default options for the command line
+// tools, resolving names from config and tracing the protocol to the standard
+// logger if verbose is set.
+func NewDialer(verbose bool, config *Config) *Dialer {
+	d := &Dialer{Config: config}
+
+	if verbose {
+		d.Logger = log.Default()
+	}
+
+	return d
+}
+
+// Pool keeps one connection open per host for working on several remote
+// files. The zero value is ready to use. A pool is not safe for concurrent
+// use.
+type Pool struct {
+	// Dialer connects to hosts on first use. The default options are used if
+	// nil.
+	Dialer *Dialer
+
+	clients map[string]*Client
+}
+
+// Client returns the connection to host, dialing it if not already open.
+func (p *Pool) Client(host string) (*Client, error) {
+	if c, ok := p.clients[host]; ok {
+		return c, nil
+	}
+
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = &Dialer{}
+	}
+
+	c, err := dialer.Dial(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.clients == nil {
+		p.clients = map[string]*Client{}
+	}
+
+	p.clients[host] = c
+
+	return c, nil
+}
+
+// Check drops the connection to host unless err is a regular command failure,
+// which leaves the connection usable for the next command.
+func (p *Pool) Check(host string, err error) {
+	var cmderr *Error
+
+	if c, ok := p.clients[host]; ok && !errors.As(err, &cmderr) {
+		c.Close()
+		delete(p.clients, host)
+	}
+}
+
+// Quit says goodbye to every host and empties the pool.
+func (p *Pool) Quit() error {
+	hosts := make([]string, 0, len(p.clients))
+	for host := range p.clients {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	var errs []error
+
+	for _, host := range hosts {
+		err := p.clients[host].Quit()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Farewell to %s failed: %w", host, err))
+		}
+
+		delete(p.clients, host)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+package xbdm
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Remote filenames are on the format "host:X:\path", where host may include
+// a port. With a config, the host may be left empty for the default console,
+// and the drive may be left out for consoles with a default partition.
+var (
+	remotePattern   = regexp.MustCompile(`^(.*):([A-Za-z]:.*)$`)
+	relativePattern = regexp.MustCompile(`^([^:\\]*):(.*)$`)
+
+	errRemoteFormat = errors.New("Remote filename must be on the format \"host:X:\\full\\path\\file\"")
+)
+
+// IsRemote reports whether name is a remote filename.
+func IsRemote(name string) bool {
+	var c *Config
+	return c.IsRemote(name)
+}
+
+// ParseRemote splits a remote filename on the format "host:X:\path" into its
+// host and console path.
+func ParseRemote(name string) (host, path string, err error) {
+	var c *Config
+	return c.ParseRemote(name)
+}
+
+// IsRemote reports whether name is a remote filename, including the forms
+// relying on the config.
+func (c *Config) IsRemote(name string) bool {
+	if match := remotePattern.FindStringSubmatch(name); match != nil {
+		return match[1] != "" || c.DefaultConsole() != ""
+	}
+
+	_, _, err := c.parseRelative(name)
+	return err == nil
+}
+
+// ParseRemote is like the package level ParseRemote, but also accepts
+// ":X:\path" for the default console and "host:path" relative to the default
+// partition of a named console.
+func (c *Config) ParseRemote(name string) (host, path string, err error) {
+	match := remotePattern.FindStringSubmatch(name)
+
+	if match == nil {
+		return c.parseRelative(name)
+	}
+
+	host, path = match[1], match[2]
+
+	if host == "" {
+		host = c.DefaultConsole()
+
+		if host == "" {
+			return "", "", ErrNoConsole
+		}
+	}
+
+	return host, path, nil
+}
+
+// Split a remote filename without a drive on a console with a default
+// partition.
+func (c *Config) parseRelative(name string) (host, path string, err error) {
+	match := relativePattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", "", errRemoteFormat
+	}
+
+	host, path = match[1], match[2]
+
+	if host == "" {
+		host = c.DefaultConsole()
+	}
+
+	console, ok := c.Console(host)
+	if !ok || console.Partition == "" {
+		return "", "", errRemoteFormat
+	}
+
+	return host, console.Partition + strings.TrimLeft(path, "\\"), nil
+}
@@ -0,0 +1,100 @@
+package xbdm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		name    string
+		console string
+		host    string
+		path    string
+		err     error
+	}{
+		{name: `kit3:E:\f`, host: "kit3", path: `E:\f`},
+		{name: `192.168.1.30:E:\f`, host: "192.168.1.30", path: `E:\f`},
+		{name: `10.0.0.4:731:E:\f`, host: "10.0.0.4:731", path: `E:\f`},
+		{name: `kit3:e:`, host: "kit3", path: `e:`},
+		{name: `kit3:f`, host: "kit3", path: `E:\f`},
+		{name: `kit3:\f`, host: "kit3", path: `E:\f`},
+		{name: `KIT4:save\f`, host: "KIT4", path: `F:\games\save\f`},
+		{name: `:E:\f`, console: "kit3", host: "kit3", path: `E:\f`},
+		{name: `:E:\f`, err: ErrNoConsole},
+		{name: `:f`, console: "kit3", host: "kit3", path: `E:\f`},
+
+		// Local filenames.
+		{name: `:f`, err: errRemoteFormat},
+		{name: `:f`, console: "devkit", err: errRemoteFormat},
+		{name: `C:\x`, err: errRemoteFormat},
+		{name: `C:x`, err: errRemoteFormat},
+		{name: `a:b`, err: errRemoteFormat},
+		{name: `devkit:f`, err: errRemoteFormat},
+		{name: `dir\a:b`, err: errRemoteFormat},
+		{name: `f`, err: errRemoteFormat},
+	}
+
+	for _, tt := range tests {
+		setUserConfig(t, testConfig, tt.console)
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		host, path, err := config.ParseRemote(tt.name)
+
+		if remote := config.IsRemote(tt.name); remote != (tt.err == nil) {
+			t.Errorf("IsRemote(%q) with %s=%q = %t, want %t", tt.name, ConsoleEnv, tt.console, remote, !remote)
+		}
+
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ParseRemote(%q) with %s=%q = %q, %q, %v, want %v", tt.name, ConsoleEnv, tt.console, host, path, err, tt.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseRemote(%q) with %s=%q failed: %v", tt.name, ConsoleEnv, tt.console, err)
+		} else if host != tt.host || path != tt.path {
+			t.Errorf("ParseRemote(%q) with %s=%q = %q, %q, want %q, %q", tt.name, ConsoleEnv, tt.console, host, path, tt.host, tt.path)
+		}
+	}
+}
+
+// Without a config, only full remote filenames are accepted.
+func TestParseRemoteWithoutConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		path string
+	}{
+		{name: `kit3:E:\f`, host: "kit3", path: `E:\f`},
+		{name: `10.0.0.4:731:E:\f`, host: "10.0.0.4:731", path: `E:\f`},
+		{name: `kit3:f`},
+		{name: `:E:\f`},
+		{name: `C:\x`},
+		{name: `a:b`},
+	}
+
+	for _, tt := range tests {
+		host, path, err := ParseRemote(tt.name)
+
+		if remote := IsRemote(tt.name); remote != (tt.host != "") {
+			t.Errorf("IsRemote(%q) = %t, want %t", tt.name, remote, !remote)
+		}
+
+		if tt.host == "" {
+			if err == nil {
+				t.Errorf("ParseRemote(%q) = %q, %q, want error", tt.name, host, path)
+			}
+		} else if err != nil {
+			t.Errorf("ParseRemote(%q) failed: %v", tt.name, err)
+		} else if host != tt.host || path != tt.path {
+			t.Errorf("ParseRemote(%q) = %q, %q, want %q, %q", tt.name, host, path, tt.host, tt.path)
+		}
+	}
+}
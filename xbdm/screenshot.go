@@ -0,0 +1,58 @@
+package xbdm
+
+import (
+	"fmt"
+	"io"
+)
+
+const CommandScreenshot = "screenshot"
+
+// Screenshot describes the framebuffer returned by the screenshot command.
+type Screenshot struct {
+	Pitch           int
+	Width           int
+	Height          int
+	Format          int
+	FramebufferSize int
+	Data            []byte
+}
+
+// Screenshot captures the current framebuffer.
+func (c *Client) Screenshot() (*Screenshot, error) {
+	_, err := c.Command(CommandScreenshot, StatusBinary)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := c.ReadLine()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read screenshot header: %w", err)
+	}
+
+	c.logf("Received screenshot header \"%s\"", header)
+
+	attrs, err := ParseAttributes(header)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &Screenshot{}
+	ss.Pitch, _ = attrs.Int("pitch")
+	ss.Width, _ = attrs.Int("width")
+	ss.Height, _ = attrs.Int("height")
+	ss.Format, _ = attrs.Int("format")
+	ss.FramebufferSize, _ = attrs.Int("framebuffersize")
+
+	if ss.Pitch <= 0 || ss.Width <= 0 || ss.Height <= 0 || ss.FramebufferSize <= 0 {
+		return nil, fmt.Errorf("Invalid screenshot header \"%s\"", header)
+	}
+
+	ss.Data = make([]byte, ss.FramebufferSize)
+
+	_, err = io.ReadFull(c.reader, ss.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Reading image data failed: %w", err)
+	}
+
+	return ss, nil
+}
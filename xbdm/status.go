@@ -0,0 +1,133 @@
+package xbdm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Status is the three digit code prefixing every debug monitor response.
+type Status int
+
+const (
+	StatusOK                Status = 200
+	StatusConnected         Status = 201
+	StatusMultiline         Status = 202
+	StatusBinary            Status = 203
+	StatusSendBinary        Status = 204
+	StatusNotification      Status = 205
+	StatusUnexpected        Status = 400
+	StatusMaxConnections    Status = 401
+	StatusFileNotFound      Status = 402
+	StatusNoSuchModule      Status = 403
+	StatusMemoryNotMapped   Status = 404
+	StatusNoSuchThread      Status = 405
+	StatusSetTimeFailed     Status = 406
+	StatusUnknownCommand    Status = 407
+	StatusNotStopped        Status = 408
+	StatusMustCopy          Status = 409
+	StatusAlreadyExists     Status = 410
+	StatusDirectoryNotEmpty Status = 411
+	StatusBadFilename       Status = 412
+	StatusCannotCreate      Status = 413
+	StatusAccessDenied      Status = 414
+	StatusDeviceFull        Status = 415
+	StatusNotDebuggable     Status = 416
+	StatusInvalidType       Status = 417
+	StatusDataNotAvailable  Status = 418
+	StatusNotLocked         Status = 420
+	StatusKeyExchange       Status = 421
+	StatusDedicated         Status = 422
+)
+
+// IsMultiline reports whether a body terminated by a "." line follows the
+// status line.
+func (s Status) IsMultiline() bool {
+	return s == StatusMultiline
+}
+
+// IsBinary reports whether raw data follows the status line.
+func (s Status) IsBinary() bool {
+	return s == StatusBinary
+}
+
+// IsError reports whether the status indicates a failed command.
+func (s Status) IsError() bool {
+	return s >= 400
+}
+
+func (s Status) String() string {
+	return strconv.Itoa(int(s))
+}
+
+// Response is a status line received from the debug monitor. The body of
+// multiline responses is stored in Lines without the terminating ".".
+type Response struct {
+	Status  Status
+	Message string
+	Lines   []string
+}
+
+// Attributes parses the status message as key=value pairs.
+func (r *Response) Attributes() (Attributes, error) {
+	return ParseAttributes(r.Message)
+}
+
+// LineAttributes parses every line of a multiline body as key=value pairs.
+func (r *Response) LineAttributes() ([]Attributes, error) {
+	list := make([]Attributes, 0, len(r.Lines))
+
+	for _, line := range r.Lines {
+		attrs, err := ParseAttributes(line)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, attrs)
+	}
+
+	return list, nil
+}
+
+func parseResponse(line string) (*Response, error) {
+	if len(line) < 4 || line[3] != '-' {
+		return nil, fmt.Errorf("Malformed response \"%s\"", line)
+	}
+
+	code, err := strconv.Atoi(line[:3])
+	if err != nil || code < 100 {
+		return nil, fmt.Errorf("Malformed response status \"%s\"", line)
+	}
+
+	message := line[4:]
+	if len(message) > 0 && message[0] == ' ' {
+		message = message[1:]
+	}
+
+	return &Response{Status: Status(code), Message: message}, nil
+}
+
+// Error is returned when the debug monitor responds with an unexpected
+// status.
+type Error struct {
+	Command  string
+	Status   Status
+	Message  string
+	Expected Status
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("Got \"%s- %s\", expected %s", e.Status, e.Message, e.Expected)
+
+	if e.Command != "" {
+		msg = fmt.Sprintf("Command \"%s\" failed: %s", e.Command, msg)
+	}
+
+	return msg
+}
+
+// IsStatus reports whether err is an *Error with the given status.
+func IsStatus(err error, status Status) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == status
+}
@@ -0,0 +1,56 @@
+package xbdm
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CommandMagicBoot = "magicboot"
+	CommandTitle     = "title"
+	CommandGo        = "go"
+)
+
+// MagicBoot reboots the console into the named title, e.g.
+// "E:\game\default.xbe". The debug monitor stays loaded if debug is set.
+func (c *Client) MagicBoot(title string, debug bool) error {
+	command := fmt.Sprintf("%s title=\"%s\"", CommandMagicBoot, title)
+
+	if debug {
+		command += " debug"
+	}
+
+	_, err := c.Command(command, StatusOK)
+	return err
+}
+
+// RebootWait restarts the console and halts before the title starts, until
+// execution is resumed with Go. A cold reboot reloads the BIOS.
+func (c *Client) RebootWait(cold bool) error {
+	command := "reboot wait"
+
+	if !cold {
+		command += " warm"
+	}
+
+	_, err := c.Command(command, StatusOK)
+	return err
+}
+
+// SetTitle selects the title started when execution is resumed after
+// RebootWait.
+func (c *Client) SetTitle(title string) error {
+	dir := Dir(title)
+	if !strings.HasSuffix(dir, string(PathSeparator)) {
+		dir += string(PathSeparator)
+	}
+
+	_, err := c.Command(fmt.Sprintf("%s dir=\"%s\" name=\"%s\"", CommandTitle, dir, Base(title)), StatusOK)
+	return err
+}
+
+// Go resumes execution.
+func (c *Client) Go() error {
+	_, err := c.Command(CommandGo, StatusOK)
+	return err
+}
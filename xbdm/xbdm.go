@@ -0,0 +1,362 @@
+// Package xbdm implements a client for the Xbox Debug Monitor protocol spoken
+// by debug enabled first generation Xbox consoles on TCP port 731.
+package xbdm
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	Port           = 731
+	DefaultTimeout = 10 * time.Second
+	MessageSuffix  = "\r\n"
+	MultilineEnd   = "."
+	PathSeparator  = '\\'
+	CommandQuit    = "bye"
+
+	CommandDebugName = "dbgname"
+)
+
+// Dialer contains options for connecting to a debug monitor.
+type Dialer struct {
+	// Timeout is the maximum time spent establishing the connection and
+	// reading the protocol banner. DefaultTimeout is used if zero.
+	Timeout time.Duration
+
+	// Logger receives protocol traces if set.
+	Logger *log.Logger
+
+	// Resolver looks up hosts by console name if they aren't found by DNS.
+	// The local network is queried if nil.
+	Resolver *Resolver
+
+	// Config maps console names to hosts before dialing if set.
+	Config *Config
+}
+
+// Client is a connection to a debug monitor.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	logger *log.Logger
+	host   string
+}
+
+// Address returns host with the debug monitor port appended unless it
+// already contains a port.
+func Address(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(Port))
+}
+
+// Dial connects to the debug monitor on host using the default options.
+func Dial(host string) (*Client, error) {
+	var d Dialer
+	return d.DialContext(context.Background(), host)
+}
+
+// DialTimeout connects to the debug monitor on host, giving up after timeout.
+func DialTimeout(host string, timeout time.Duration) (*Client, error) {
+	d := Dialer{Timeout: timeout}
+	return d.DialContext(context.Background(), host)
+}
+
+// Dial connects to the debug monitor on host.
+func (d *Dialer) Dial(host string) (*Client, error) {
+	return d.DialContext(context.Background(), host)
+}
+
+// DialContext connects to the debug monitor on host and reads the protocol
+// banner.
+func (d *Dialer) DialContext(ctx context.Context, host string) (*Client, error) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	address := Address(d.Config.Resolve(host))
+
+	if d.Logger != nil {
+		d.Logger.Printf("Connecting to %s", address)
+	}
+
+	nd := net.Dialer{Timeout: timeout}
+	conn, err := nd.DialContext(ctx, "tcp", address)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		conn, err = d.dialName(ctx, &nd, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+		logger: d.Logger,
+		host:   host,
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	_, err = c.ReadResponse(StatusConnected)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error reading protocol banner: %w", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return c, nil
+}
+
+// Connect to a host not found by DNS by looking it up as a console name.
+func (d *Dialer) dialName(ctx context.Context, nd *net.Dialer, address string) (net.Conn, error) {
+	name, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = &Resolver{}
+	}
+
+	console, err := resolver.Lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	address = net.JoinHostPort(console.IP.String(), port)
+
+	if d.Logger != nil {
+		d.Logger.Printf("Found console \"%s\", connecting to %s", console.Name, address)
+	}
+
+	return nd.DialContext(ctx, "tcp", address)
+}
+
+// Host returns the host the client was dialed with.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// SetDeadline sets the read and write deadline of the underlying connection.
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Close closes the connection without saying goodbye.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Quit says goodbye to the debug monitor and closes the connection.
+func (c *Client) Quit() error {
+	defer c.conn.Close()
+
+	_, err := c.Command(CommandQuit, StatusOK)
+	return err
+}
+
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// Command sends command and reads its response, which must have the expected
+// status.
+func (c *Client) Command(command string, expected Status) (*Response, error) {
+	err := c.send(command)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.ReadResponse(expected)
+	if err, ok := err.(*Error); ok {
+		err.Command = command
+	}
+
+	return resp, err
+}
+
+func (c *Client) send(command string) error {
+	c.logf("Sending command \"%s\"", command)
+
+	_, err := c.writer.WriteString(command + MessageSuffix)
+	if err != nil {
+		return err
+	}
+
+	return c.writer.Flush()
+}
+
+// ReadLine reads a single CRLF terminated line.
+func (c *Client) ReadLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	return line, nil
+}
+
+// ReadResponse reads a status line and, for multiline responses, the body
+// following it. An *Error is returned if the status differs from expected,
+// unless expected is zero. Binary data following the status line is left
+// unread.
+func (c *Client) ReadResponse(expected Status) (*Response, error) {
+	line, err := c.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	c.logf("Received response \"%s\"", line)
+
+	resp, err := parseResponse(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status.IsMultiline() {
+		resp.Lines, err = c.readMultiline()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if expected != 0 && resp.Status != expected {
+		return resp, &Error{Status: resp.Status, Message: resp.Message, Expected: expected}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) readMultiline() ([]string, error) {
+	var lines []string
+
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading multiline response: %w", err)
+		}
+
+		if line == MultilineEnd {
+			return lines, nil
+		}
+
+		c.logf("Received line \"%s\"", line)
+
+		lines = append(lines, line)
+	}
+}
+
+// CommandLines sends command and returns the body of its multiline response.
+func (c *Client) CommandLines(command string) ([]string, error) {
+	resp, err := c.Command(command, StatusMultiline)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Lines, nil
+}
+
+// CommandAttributes sends command and parses every line of its multiline
+// response as key=value pairs.
+func (c *Client) CommandAttributes(command string) ([]Attributes, error) {
+	resp, err := c.Command(command, StatusMultiline)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.LineAttributes()
+}
+
+// CommandBinary sends command and reads its binary response, which is
+// prefixed by a 32 bit little endian length.
+func (c *Client) CommandBinary(command string) ([]byte, error) {
+	_, err := c.Command(command, StatusBinary)
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := c.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+
+	_, err = io.ReadFull(c.reader, data)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading binary response: %w", err)
+	}
+
+	return data, nil
+}
+
+// ReadLength reads the 32 bit little endian length prefixing a binary
+// response.
+func (c *Client) ReadLength() (int64, error) {
+	var buf [4]byte
+
+	_, err := io.ReadFull(c.reader, buf[:])
+	if err != nil {
+		return 0, fmt.Errorf("Error reading binary response length: %w", err)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(buf[:]))
+
+	c.logf("Receiving %d bytes of binary data", length)
+
+	return length, nil
+}
+
+// Read reads raw data following a binary response.
+func (c *Client) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Reboot restarts the console. A cold reboot reloads the BIOS.
+func (c *Client) Reboot(cold bool) error {
+	command := "reboot"
+
+	if !cold {
+		command += " warm"
+	}
+
+	_, err := c.Command(command, StatusOK)
+	return err
+}
+
+// DebugName returns the name of the console.
+func (c *Client) DebugName() (string, error) {
+	resp, err := c.Command(CommandDebugName, StatusOK)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Message, nil
+}
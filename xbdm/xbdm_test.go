@@ -0,0 +1,210 @@
+package xbdm
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		line    string
+		status  Status
+		message string
+		err     bool
+	}{
+		{line: "200- OK", status: StatusOK, message: "OK"},
+		{line: "201- connected", status: StatusConnected, message: "connected"},
+		{line: "202- multiline response follows", status: StatusMultiline, message: "multiline response follows"},
+		{line: "402- file not found", status: StatusFileNotFound, message: "file not found"},
+		{line: "200-", status: StatusOK, message: ""},
+		{line: "200-OK", status: StatusOK, message: "OK"},
+		{line: "200-  two spaces", status: StatusOK, message: " two spaces"},
+		{line: "", err: true},
+		{line: "200", err: true},
+		{line: "200 OK", err: true},
+		{line: "2x0- OK", err: true},
+		{line: "-20- OK", err: true},
+		{line: "099- OK", err: true},
+	}
+
+	for _, tt := range tests {
+		resp, err := parseResponse(tt.line)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseResponse(%q) = %+v, want error", tt.line, resp)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseResponse(%q) failed: %v", tt.line, err)
+		} else if resp.Status != tt.status || resp.Message != tt.message {
+			t.Errorf("parseResponse(%q) = %s %q, want %s %q", tt.line, resp.Status, resp.Message, tt.status, tt.message)
+		}
+	}
+}
+
+func newTestClient(input string) *Client {
+	return &Client{reader: bufio.NewReader(strings.NewReader(input))}
+}
+
+func TestReadMultiline(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+		rest  string
+		err   bool
+	}{
+		{name: "empty", input: ".\r\n"},
+		{name: "lines", input: "name=\"E:\\a\"\r\nname=\"E:\\b\"\r\n.\r\n", lines: []string{`name="E:\a"`, `name="E:\b"`}},
+		{name: "bare newlines", input: "a\nb\n.\n", lines: []string{"a", "b"}},
+		{name: "empty line", input: "a\r\n\r\nb\r\n.\r\n", lines: []string{"a", "", "b"}},
+		{name: "dot prefix", input: ".a\r\n..\r\n.\r\n", lines: []string{".a", ".."}},
+		{name: "trailing data", input: "a\r\n.\r\n200- OK\r\n", lines: []string{"a"}, rest: "200- OK\r\n"},
+		{name: "unterminated", input: "a\r\nb\r\n", err: true},
+		{name: "truncated line", input: "a\r\nb", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(tt.input)
+
+			lines, err := c.readMultiline()
+
+			if tt.err {
+				if err == nil {
+					t.Fatalf("readMultiline() = %q, want error", lines)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readMultiline() failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("readMultiline() = %q, want %q", lines, tt.lines)
+			}
+
+			var rest strings.Builder
+			c.reader.WriteTo(&rest)
+
+			if rest.String() != tt.rest {
+				t.Errorf("Left %q unread, want %q", rest.String(), tt.rest)
+			}
+		})
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Status
+		status   Status
+		lines    []string
+		err      bool
+	}{
+		{name: "ok", input: "200- OK\r\n", expected: StatusOK, status: StatusOK},
+		{name: "multiline", input: "202- multiline response follows\r\na=1\r\n.\r\n", expected: StatusMultiline, status: StatusMultiline, lines: []string{"a=1"}},
+		{name: "any status", input: "402- file not found\r\n", status: StatusFileNotFound},
+		{name: "unexpected status", input: "402- file not found\r\n", expected: StatusOK, status: StatusFileNotFound, err: true},
+		{name: "malformed", input: "OK\r\n", expected: StatusOK, err: true},
+		{name: "unterminated multiline", input: "202- multiline response follows\r\na=1\r\n", expected: StatusMultiline, err: true},
+		{name: "eof", input: "", expected: StatusOK, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newTestClient(tt.input).ReadResponse(tt.expected)
+
+			if tt.err != (err != nil) {
+				t.Fatalf("ReadResponse(%s) error = %v, want error %v", tt.expected, err, tt.err)
+			}
+
+			if tt.status != 0 && (resp == nil || resp.Status != tt.status) {
+				t.Fatalf("ReadResponse(%s) = %+v, want status %s", tt.expected, resp, tt.status)
+			}
+
+			if resp != nil && !reflect.DeepEqual(resp.Lines, tt.lines) {
+				t.Errorf("ReadResponse(%s) lines = %q, want %q", tt.expected, resp.Lines, tt.lines)
+			}
+
+			if tt.err && tt.status != 0 && !IsStatus(err, tt.status) {
+				t.Errorf("IsStatus(%v, %s) = false", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		line  string
+		attrs Attributes
+		err   bool
+	}{
+		{line: "", attrs: Attributes{}},
+		{line: "key=value", attrs: Attributes{"key": "value"}},
+		{line: "Name=\"E:\\dir with spaces\\file.xbe\" directory", attrs: Attributes{"name": `E:\dir with spaces\file.xbe`, "directory": ""}},
+		{line: "sizehi=0x0 sizelo=0x1234", attrs: Attributes{"sizehi": "0x0", "sizelo": "0x1234"}},
+		{line: "format=0x00000012, framebuffersize=0x0012c000", attrs: Attributes{"format": "0x00000012", "framebuffersize": "0x0012c000"}},
+		{line: "  a=1\tb=2  ", attrs: Attributes{"a": "1", "b": "2"}},
+		{line: "empty=\"\" flag", attrs: Attributes{"empty": "", "flag": ""}},
+		{line: "key=", attrs: Attributes{"key": ""}},
+		{line: "name=\"unterminated", err: true},
+	}
+
+	for _, tt := range tests {
+		attrs, err := ParseAttributes(tt.line)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseAttributes(%q) = %q, want error", tt.line, attrs)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseAttributes(%q) failed: %v", tt.line, err)
+		} else if !reflect.DeepEqual(attrs, tt.attrs) {
+			t.Errorf("ParseAttributes(%q) = %q, want %q", tt.line, attrs, tt.attrs)
+		}
+	}
+}
+
+func TestAttributeValues(t *testing.T) {
+	attrs, err := ParseAttributes("sizehi=0x1 sizelo=0x2 count=42 bad=0xzz createhi=0x01c5a9f4 createlo=0x7d1ac000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := attrs.Uint64("sizehi", "sizelo"); err != nil || n != 1<<32|2 {
+		t.Errorf("Uint64(sizehi, sizelo) = %#x, %v", n, err)
+	}
+
+	if n, err := attrs.Int("count"); err != nil || n != 42 {
+		t.Errorf("Int(count) = %d, %v", n, err)
+	}
+
+	if _, err := attrs.Uint("bad"); err == nil {
+		t.Error("Uint(bad) succeeded")
+	}
+
+	if _, err := attrs.Uint("missing"); err == nil {
+		t.Error("Uint(missing) succeeded")
+	}
+
+	tm, err := attrs.Time("createhi", "createlo")
+	if err != nil {
+		t.Fatal(err)
+	} else if ToFileTime(tm) != 0x01c5a9f47d1ac000 {
+		t.Errorf("ToFileTime(Time(createhi, createlo)) = %#x", ToFileTime(tm))
+	}
+}
@@ -0,0 +1,439 @@
+package xbdmtest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+var errBadFilename = errors.New("filename is invalid")
+
+func (s *Server) handleDefaults() {
+	s.handlers["bye"] = handleBye
+	s.handlers["reboot"] = handleReboot
+	s.handlers["screenshot"] = handleScreenshot
+	s.handlers["sendfile"] = handleSendFile
+	s.handlers["getfile"] = handleGetFile
+	s.handlers["getfileattributes"] = handleGetFileAttributes
+	s.handlers["setfileattributes"] = handleSetFileAttributes
+	s.handlers["dirlist"] = handleDirList
+	s.handlers["drivelist"] = handleDriveList
+	s.handlers["mkdir"] = handleMkdir
+	s.handlers["delete"] = handleDelete
+	s.handlers["rename"] = handleRename
+	s.handlers["notify"] = handleNotify
+	s.handlers["getexecstate"] = handleExecState
+	s.handlers["magicboot"] = handleMagicBoot
+	s.handlers["title"] = handleTitle
+	s.handlers["go"] = handleGo
+	s.handlers["dbgname"] = handleDebugName
+}
+
+// Path maps the console path name to a local path below the server root.
+func (s *Server) Path(name string) (string, error) {
+	if len(name) < 2 || name[1] != ':' || !isDriveLetter(name[0]) {
+		return "", errBadFilename
+	}
+
+	parts := []string{s.Root, strings.ToUpper(name[:1])}
+
+	for _, part := range strings.Split(name[2:], string(xbdm.PathSeparator)) {
+		if part == "." || part == ".." || strings.ContainsRune(part, '/') {
+			return "", errBadFilename
+		}
+
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return filepath.Join(parts...), nil
+}
+
+func isDriveLetter(b byte) bool {
+	return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z'
+}
+
+func errorStatus(err error) (xbdm.Status, string) {
+	switch {
+	case errors.Is(err, errBadFilename):
+		return xbdm.StatusBadFilename, "filename is invalid"
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		return xbdm.StatusFileNotFound, "file not found"
+	case errors.Is(err, fs.ErrExist):
+		return xbdm.StatusAlreadyExists, "file already exists"
+	case errors.Is(err, fs.ErrPermission):
+		return xbdm.StatusAccessDenied, "access denied"
+	}
+
+	return xbdm.StatusUnexpected, err.Error()
+}
+
+// FileAttributes formats info the way the debug monitor describes files.
+func FileAttributes(info os.FileInfo) string {
+	size := uint64(info.Size())
+	if info.IsDir() {
+		size = 0
+	}
+
+	ft := xbdm.ToFileTime(info.ModTime())
+
+	attrs := fmt.Sprintf("sizehi=0x%x sizelo=0x%x createhi=0x%08x createlo=0x%08x changehi=0x%08x changelo=0x%08x",
+		size>>32, size&0xffffffff, ft>>32, ft&0xffffffff, ft>>32, ft&0xffffffff)
+
+	if info.IsDir() {
+		attrs += " directory"
+	}
+
+	return attrs
+}
+
+func (c *Conn) path(cmd *Command, key string) (string, bool) {
+	name, err := cmd.Attrs.String(key)
+	if err != nil {
+		c.Respond(xbdm.StatusUnexpected, err.Error())
+		return "", false
+	}
+
+	path, err := c.Server.Path(name)
+	if err != nil {
+		c.RespondError(err)
+		return "", false
+	}
+
+	return path, true
+}
+
+func handleBye(c *Conn, cmd *Command) {
+	c.Respond(xbdm.StatusOK, "bye")
+	c.Close()
+}
+
+// The fake console is back instantly, with the title already started unless
+// told to wait. Channels opened after the reboot don't see the title start.
+func handleReboot(c *Conn, cmd *Command) {
+	c.Server.Notify(xbdm.NotificationExecutionRebooting)
+
+	c.Server.mu.Lock()
+	c.Server.reboots++
+	c.Server.state = xbdm.ExecStateStarted
+	if cmd.Attrs.Has("wait") {
+		c.Server.state = xbdm.ExecStatePending
+	}
+	c.Server.mu.Unlock()
+
+	c.Respond(xbdm.StatusOK, "OK")
+	c.Close()
+}
+
+func handleDebugName(c *Conn, cmd *Command) {
+	c.Server.mu.Lock()
+	name := c.Server.name
+	c.Server.mu.Unlock()
+
+	c.Respond(xbdm.StatusOK, name)
+}
+
+func handleMagicBoot(c *Conn, cmd *Command) {
+	title, ok := cmd.Attrs["title"]
+	if !ok {
+		c.Respond(xbdm.StatusUnexpected, "missing title")
+		return
+	}
+
+	c.Server.mu.Lock()
+	c.Server.title = title
+	c.Server.mu.Unlock()
+
+	handleReboot(c, cmd)
+}
+
+func handleTitle(c *Conn, cmd *Command) {
+	dir, name := cmd.Attrs["dir"], cmd.Attrs["name"]
+	if dir == "" || name == "" {
+		c.Respond(xbdm.StatusUnexpected, "missing dir or name")
+		return
+	}
+
+	c.Server.mu.Lock()
+	c.Server.title = xbdm.Join(dir, name)
+	c.Server.mu.Unlock()
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
+
+func handleGo(c *Conn, cmd *Command) {
+	c.Respond(xbdm.StatusOK, "OK")
+	c.Server.SetExecState(xbdm.ExecStateStarted)
+}
+
+// Only events after the channel is opened are sent, use getexecstate for the
+// current state.
+func handleNotify(c *Conn, cmd *Command) {
+	c.Respond(xbdm.StatusNotification, "now a notification channel")
+
+	c.Server.mu.Lock()
+	c.Server.notifiers[c] = true
+	c.Server.mu.Unlock()
+}
+
+func handleExecState(c *Conn, cmd *Command) {
+	c.Respond(xbdm.StatusOK, c.Server.ExecState())
+}
+
+func handleScreenshot(c *Conn, cmd *Command) {
+	c.Server.mu.Lock()
+	screen := c.Server.screen
+	c.Server.mu.Unlock()
+
+	if screen == nil {
+		c.Respond(xbdm.StatusDataNotAvailable, "data not available")
+		return
+	}
+
+	c.Respond(xbdm.StatusBinary, "binary response follows")
+	c.WriteLine(screen.Header())
+	c.Write(screen.Data)
+}
+
+func handleSendFile(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	length, err := cmd.Attrs.Uint("length")
+	if err != nil {
+		c.Respond(xbdm.StatusUnexpected, err.Error())
+		return
+	}
+
+	if info, err := os.Stat(filepath.Dir(path)); err != nil {
+		c.RespondError(err)
+		return
+	} else if !info.IsDir() {
+		c.Respond(xbdm.StatusCannotCreate, "file cannot be created")
+		return
+	}
+
+	c.Respond(xbdm.StatusSendBinary, "send binary data")
+
+	data, err := c.ReadBinary(int64(length))
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	err = os.WriteFile(path, data, 0666)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
+
+func handleGetFile(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	if cmd.Attrs.Has("offset") {
+		offset, _ := cmd.Attrs.Uint("offset")
+		if offset > uint64(len(data)) {
+			offset = uint64(len(data))
+		}
+
+		data = data[offset:]
+	}
+
+	if cmd.Attrs.Has("size") {
+		size, _ := cmd.Attrs.Uint("size")
+		if size < uint64(len(data)) {
+			data = data[:size]
+		}
+	}
+
+	c.RespondBinary(data)
+}
+
+// Drive roots have no attributes, like on the console.
+func handleGetFileAttributes(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	} else if xbdm.IsRoot(cmd.Attrs["name"]) {
+		c.Respond(xbdm.StatusFileNotFound, "file not found")
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	c.RespondLines([]string{FileAttributes(info)})
+}
+
+func handleSetFileAttributes(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	// Only the modification time is kept by the host file system.
+	changed := info.ModTime()
+	if cmd.Attrs.Has("changehi") {
+		changed, err = cmd.Attrs.Time("changehi", "changelo")
+		if err != nil {
+			c.Respond(xbdm.StatusUnexpected, err.Error())
+			return
+		}
+	}
+
+	err = os.Chtimes(path, changed, changed)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
+
+func handleDirList(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	lines := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("name=\"%s\" %s", entry.Name(), FileAttributes(info)))
+	}
+
+	c.RespondLines(lines)
+}
+
+func handleDriveList(c *Conn, cmd *Command) {
+	entries, err := os.ReadDir(c.Server.Root)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	var drives []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && len(name) == 1 && isDriveLetter(name[0]) {
+			drives = append(drives, strings.ToUpper(name))
+		}
+	}
+
+	sort.Strings(drives)
+
+	c.Respond(xbdm.StatusOK, strings.Join(drives, ""))
+}
+
+func handleMkdir(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	err := os.Mkdir(path, 0777)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
+
+func handleDelete(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	if info.IsDir() != cmd.Attrs.Has("dir") {
+		c.Respond(xbdm.StatusInvalidType, "type invalid")
+		return
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		if info.IsDir() {
+			c.Respond(xbdm.StatusDirectoryNotEmpty, "directory not empty")
+		} else {
+			c.RespondError(err)
+		}
+		return
+	}
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
+
+func handleRename(c *Conn, cmd *Command) {
+	path, ok := c.path(cmd, "name")
+	if !ok {
+		return
+	}
+
+	newpath, ok := c.path(cmd, "newname")
+	if !ok {
+		return
+	}
+
+	if _, err := os.Stat(newpath); err == nil {
+		c.Respond(xbdm.StatusAlreadyExists, "file already exists")
+		return
+	}
+
+	err := os.Rename(path, newpath)
+	if err != nil {
+		c.RespondError(err)
+		return
+	}
+
+	c.Respond(xbdm.StatusOK, "OK")
+}
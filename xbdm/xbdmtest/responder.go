@@ -0,0 +1,84 @@
+package xbdmtest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+// Responder answers name answering protocol queries on a loopback UDP port,
+// standing in for a console on the local network.
+type Responder struct {
+	name string
+	conn *net.UDPConn
+	mu   sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// NewResponder starts a responder on a random loopback port answering to
+// name. Point xbdm.Resolver.Address at Addr to query it.
+func NewResponder(name string) (*Responder, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Responder{name: name, conn: conn}
+
+	r.wg.Add(1)
+	go r.serve()
+
+	return r, nil
+}
+
+// Addr returns the host:port the responder is listening on.
+func (r *Responder) Addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+// SetName changes the console name answered with.
+func (r *Responder) SetName(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.name = name
+}
+
+// Close stops the responder.
+func (r *Responder) Close() error {
+	err := r.conn.Close()
+	r.wg.Wait()
+
+	return err
+}
+
+func (r *Responder) serve() {
+	defer r.wg.Done()
+
+	buf := make([]byte, 2+xbdm.MaxNameLength)
+
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		kind, name, err := xbdm.ParseNamePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		r.mu.Lock()
+		own := r.name
+		r.mu.Unlock()
+
+		if kind == xbdm.NameWildcard || (kind == xbdm.NameLookup && strings.EqualFold(name, own)) {
+			reply, err := xbdm.NamePacket(xbdm.NameReply, own)
+			if err == nil {
+				r.conn.WriteToUDP(reply, from)
+			}
+		}
+	}
+}
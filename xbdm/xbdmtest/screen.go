@@ -0,0 +1,46 @@
+package xbdmtest
+
+import (
+	"fmt"
+)
+
+// FormatBGRA is the D3DFORMAT code of linear 32 bit framebuffers.
+const FormatBGRA = 18
+
+// Screen is a framebuffer served by the screenshot command.
+type Screen struct {
+	Pitch  int
+	Width  int
+	Height int
+	Format int
+	Data   []byte
+}
+
+// NewScreen returns a BGRA framebuffer filled with a gradient.
+func NewScreen(width, height int) *Screen {
+	s := &Screen{
+		Pitch:  width * 4,
+		Width:  width,
+		Height: height,
+		Format: FormatBGRA,
+		Data:   make([]byte, width*4*height),
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*s.Pitch + x*4
+			s.Data[i] = byte(x)
+			s.Data[i+1] = byte(y)
+			s.Data[i+2] = byte(x + y)
+			s.Data[i+3] = 0xff
+		}
+	}
+
+	return s
+}
+
+// Header returns the line preceding the framebuffer data.
+func (s *Screen) Header() string {
+	return fmt.Sprintf("pitch=0x%08x width=0x%08x height=0x%08x format=0x%08x, framebuffersize=0x%08x",
+		s.Pitch, s.Width, s.Height, s.Format, len(s.Data))
+}
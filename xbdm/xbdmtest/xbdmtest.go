@@ -0,0 +1,389 @@
+// Package xbdmtest provides a scriptable in-process Xbox Debug Monitor for
+// exercising xbdm clients without a console.
+//
+// Drive letters map to single letter subdirectories of the server root, so
+// "E:\dir\file" is served from filepath.Join(root, "E", "dir", "file").
+package xbdmtest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+const (
+	Banner      = "201- connected"
+	DefaultName = "xbdmtest"
+)
+
+// Command is a parsed command line received by the server.
+type Command struct {
+	Name  string
+	Line  string
+	Attrs xbdm.Attributes
+}
+
+// Handler serves a single command.
+type Handler func(c *Conn, cmd *Command)
+
+// Server is a fake debug monitor listening on a loopback port.
+type Server struct {
+	// Root is the directory backing the console drives.
+	Root string
+
+	banner    string
+	name      string
+	screen    *Screen
+	listener  net.Listener
+	handlers  map[string]Handler
+	commands  []string
+	reboots   int
+	title     string
+	state     string
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	conns     map[net.Conn]bool
+	notifiers map[*Conn]bool
+}
+
+// Conn is a client connection to the server.
+type Conn struct {
+	Server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	closed bool
+	mu     sync.Mutex
+}
+
+// NewServer starts a server on a random loopback port serving files from
+// root.
+func NewServer(root string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Root:      root,
+		banner:    Banner,
+		name:      DefaultName,
+		screen:    NewScreen(640, 480),
+		state:     xbdm.ExecStateStarted,
+		listener:  listener,
+		handlers:  map[string]Handler{},
+		conns:     map[net.Conn]bool{},
+		notifiers: map[*Conn]bool{},
+	}
+
+	s.handleDefaults()
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns the host:port the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+// SetBanner changes the line sent to new connections, for example to
+// something malformed.
+func (s *Server) SetBanner(banner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.banner = banner
+}
+
+// SetName changes the name returned by the dbgname command.
+func (s *Server) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.name = name
+}
+
+// SetScreen changes the framebuffer served by the screenshot command. The
+// command fails with StatusDataNotAvailable if screen is nil.
+func (s *Server) SetScreen(screen *Screen) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.screen = screen
+}
+
+// Handle registers handler for the named command, replacing any existing
+// handler.
+func (s *Server) Handle(name string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[strings.ToLower(name)] = handler
+}
+
+// Handler returns the handler registered for the named command, for wrapping
+// it in a new one. It returns nil if there is none.
+func (s *Server) Handler(name string) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.handlers[strings.ToLower(name)]
+}
+
+// Commands returns every command line received so far.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Reboots returns the number of reboot commands served.
+func (s *Server) Reboots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reboots
+}
+
+// Notify sends message to every notification channel.
+func (s *Server) Notify(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.notifiers {
+		c.WriteLine(message)
+	}
+}
+
+// ExecState returns the execution state reported by getexecstate.
+func (s *Server) ExecState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+// SetExecState changes the execution state and sends the matching event to
+// every notification channel.
+func (s *Server) SetExecState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+
+	s.Notify("execution " + state)
+}
+
+// Title returns the title last selected by magicboot or title commands.
+func (s *Server) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.title
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+
+	c := &Conn{
+		Server: s,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+
+	defer func() {
+		conn.Close()
+
+		s.mu.Lock()
+		delete(s.conns, conn)
+		delete(s.notifiers, c)
+		s.mu.Unlock()
+	}()
+
+	s.mu.Lock()
+	banner := s.banner
+	s.mu.Unlock()
+
+	c.WriteLine(banner)
+
+	for !c.closed {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		cmd, err := parseCommand(line)
+		if err != nil {
+			c.Respond(xbdm.StatusUnexpected, err.Error())
+			continue
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		handler, ok := s.handlers[cmd.Name]
+		s.mu.Unlock()
+
+		if !ok {
+			c.Respond(xbdm.StatusUnknownCommand, "unknown command")
+			continue
+		}
+
+		handler(c, cmd)
+	}
+}
+
+func parseCommand(line string) (*Command, error) {
+	name := line
+	rest := ""
+
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		name, rest = line[:i], line[i+1:]
+	}
+
+	attrs, err := xbdm.ParseAttributes(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Command{Name: strings.ToLower(name), Line: line, Attrs: attrs}, nil
+}
+
+// WriteLine writes line followed by CRLF.
+func (c *Conn) WriteLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writer.WriteString(line + xbdm.MessageSuffix)
+	c.writer.Flush()
+}
+
+// Write writes raw data to the client.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, c.writer.Flush()
+}
+
+// Read reads raw data from the client.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Respond writes a status line.
+func (c *Conn) Respond(status xbdm.Status, message string) {
+	c.WriteLine(fmt.Sprintf("%d- %s", status, message))
+}
+
+// RespondLines writes a multiline response.
+func (c *Conn) RespondLines(lines []string) {
+	c.Respond(xbdm.StatusMultiline, "multiline response follows")
+
+	for _, line := range lines {
+		c.WriteLine(line)
+	}
+
+	c.WriteLine(xbdm.MultilineEnd)
+}
+
+// RespondBinary writes a binary response prefixed by its length.
+func (c *Conn) RespondBinary(data []byte) {
+	c.Respond(xbdm.StatusBinary, "binary response follows")
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(data)))
+
+	c.Write(length[:])
+	c.Write(data)
+}
+
+// RespondError writes a status line describing err.
+func (c *Conn) RespondError(err error) {
+	status, message := errorStatus(err)
+	c.Respond(status, message)
+}
+
+// Close ends the connection after the current handler returns.
+func (c *Conn) Close() {
+	c.closed = true
+}
+
+// ReadBinary reads length bytes sent by the client after a 204 response.
+func (c *Conn) ReadBinary(length int64) ([]byte, error) {
+	data := make([]byte, length)
+
+	_, err := io.ReadFull(c.reader, data)
+
+	return data, err
+}
+
+// Respond returns a handler answering every command with a fixed status.
+func Respond(status xbdm.Status, message string) Handler {
+	return func(c *Conn, cmd *Command) {
+		c.Respond(status, message)
+	}
+}
+
+// Raw returns a handler writing data verbatim, for malformed responses.
+func Raw(data string) Handler {
+	return func(c *Conn, cmd *Command) {
+		c.Write([]byte(data))
+	}
+}
+
+// Hangup returns a handler closing the connection without a response.
+func Hangup() Handler {
+	return func(c *Conn, cmd *Command) {
+		c.Close()
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+const (
+	DateLayout = "2006-01-02 15:04"
+)
+
+var (
+	verbose    bool
+	long       bool
+	recursive  bool
+	jsonOutput bool
+
+	// Entries are collected for JSON output and printed at the end.
+	entries = []Entry{}
+
+	// Named consoles and the default console.
+	config *xbdm.Config
+)
+
+type Entry struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+	Changed   time.Time `json:"changed"`
+	Directory bool      `json:"directory"`
+}
+
+func printEntry(entry Entry) {
+	if jsonOutput {
+		entries = append(entries, entry)
+		return
+	}
+
+	name := entry.Name
+	if entry.Directory {
+		name += string(xbdm.PathSeparator)
+	}
+
+	if !long {
+		fmt.Println(name)
+		return
+	}
+
+	kind := "-"
+	if entry.Directory {
+		kind = "d"
+	}
+
+	changed := ""
+	if !entry.Changed.IsZero() {
+		changed = entry.Changed.Local().Format(DateLayout)
+	}
+
+	fmt.Printf("%s %10s %16s %s\n", kind, xbdm.FormatSize(entry.Size), changed, name)
+}
+
+func newEntry(dir string, file *xbdm.FileInfo) Entry {
+	return Entry{
+		Name:      file.Name,
+		Path:      xbdm.Join(dir, file.Name),
+		Size:      file.Size,
+		Created:   file.Created,
+		Changed:   file.Changed,
+		Directory: file.IsDir,
+	}
+}
+
+func listDrives(client *xbdm.Client) {
+	drives, err := client.DriveList()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sort.Strings(drives)
+
+	for _, drive := range drives {
+		printEntry(Entry{Name: drive + ":", Path: drive + ":" + string(xbdm.PathSeparator), Directory: true})
+	}
+}
+
+func listDir(client *xbdm.Client, dir string, header bool) {
+	files, err := client.DirList(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
+	})
+
+	if header && !jsonOutput {
+		fmt.Printf("%s:\n", dir)
+	}
+
+	for _, file := range files {
+		printEntry(newEntry(dir, file))
+	}
+
+	if !recursive {
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir {
+			if !jsonOutput {
+				fmt.Println()
+			}
+
+			listDir(client, xbdm.Join(dir, file.Name), true)
+		}
+	}
+}
+
+func list(target string) {
+	host, path := target, ""
+
+	if config.IsRemote(target) {
+		var err error
+
+		host, path, err = config.ParseRemote(target)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	client, err := xbdm.NewDialer(verbose, config).Dial(host)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if path == "" {
+		listDrives(client)
+	} else {
+		stat, err := client.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if stat.IsDir {
+			listDir(client, path, recursive)
+		} else {
+			printEntry(newEntry(xbdm.Dir(path), stat))
+		}
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(data))
+	}
+
+	err = client.Quit()
+	if err != nil {
+		log.Fatal("Farewell failed: ", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-l] [-R] [-json] [-v] host[:X:\\path]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func init() {
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&long, "l", false, "long listing with sizes and modification times")
+	flag.BoolVar(&recursive, "R", false, "list subdirectories recursively")
+	flag.BoolVar(&jsonOutput, "json", false, "JSON output")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+
+	config = xbdm.UserConfig()
+
+	if flag.NArg() != 1 {
+		usage()
+	}
+
+	list(flag.Args()[0])
+}
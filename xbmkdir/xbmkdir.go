@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+var (
+	verbose bool
+	parents bool
+
+	// Connections are kept open for all targets.
+	pool   xbdm.Pool
+	failed int
+
+	// Named consoles and the default console.
+	config *xbdm.Config
+)
+
+func mkdir(target string) error {
+	host, path, err := config.ParseRemote(target)
+	if err != nil {
+		return err
+	}
+
+	path = strings.TrimRight(path, string(xbdm.PathSeparator))
+
+	client, err := pool.Client(host)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		log.Printf("Creating directory %s:\"%s\"", host, path)
+	}
+
+	if parents {
+		err = client.MkdirAll(path)
+	} else {
+		err = client.Mkdir(path)
+	}
+
+	if err != nil {
+		pool.Check(host, err)
+	}
+
+	return err
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-p] [-v] host:X:\\path...\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func init() {
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&parents, "p", false, "create missing parent directories, no error if existing")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+
+	config = xbdm.UserConfig()
+
+	pool.Dialer = xbdm.NewDialer(verbose, config)
+
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	for _, target := range flag.Args() {
+		err := mkdir(target)
+		if err != nil {
+			failed++
+			log.Print(err)
+		}
+	}
+
+	err := pool.Quit()
+	if err != nil {
+		log.Print(err)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+// Start a fake console with an E drive holding a directory and a file, and a
+// fresh connection pool.
+func newServer(t *testing.T) *xbdmtest.Server {
+	t.Helper()
+
+	root := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, "E", "dir"), 0777)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(root, "E", "file"), nil, 0666)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := xbdmtest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = xbdm.Pool{}
+
+	t.Cleanup(func() {
+		pool.Quit()
+		server.Close()
+	})
+
+	return server
+}
+
+// Hang up on the first command, then serve the rest with handler.
+func hangupOnce(handler xbdmtest.Handler) xbdmtest.Handler {
+	var calls atomic.Int32
+
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		if calls.Add(1) == 1 {
+			c.Close()
+			return
+		}
+
+		handler(c, cmd)
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		parents bool
+		setup   func(s *xbdmtest.Server)
+		want    []string
+		failed  int
+		status  xbdm.Status
+	}{
+		{name: "directory", targets: []string{`E:\new`}, want: []string{"E/new"}},
+		{name: "trailing separator", targets: []string{`E:\new\`}, want: []string{"E/new"}},
+		{name: "missing parent", targets: []string{`E:\new\sub`}, failed: 1},
+		{name: "existing", targets: []string{`E:\dir`}, failed: 1, status: xbdm.StatusAlreadyExists},
+		{name: "parents", targets: []string{`E:\new\sub\deeper`}, parents: true, want: []string{"E/new/sub/deeper"}},
+		{name: "parents existing", targets: []string{`E:\dir`, `E:\`}, parents: true, want: []string{"E/dir"}},
+		{name: "parents through file", targets: []string{`E:\file\sub`}, parents: true, failed: 1},
+		{
+			name: "refused", targets: []string{`E:\new`}, failed: 1, status: xbdm.StatusCannotCreate,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("mkdir", xbdmtest.Respond(xbdm.StatusCannotCreate, "cannot create file"))
+			},
+		},
+		{
+			// The dropped connection is replaced for the next target.
+			name: "redial", targets: []string{`E:\a`, `E:\b`}, failed: 1, want: []string{"E/b"},
+			setup: func(s *xbdmtest.Server) { s.Handle("mkdir", hangupOnce(s.Handler("mkdir"))) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verbose, parents, config = false, tt.parents, nil
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			failures := 0
+
+			for _, target := range tt.targets {
+				err := mkdir(server.Addr() + ":" + target)
+				if err != nil {
+					failures++
+
+					if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+						t.Errorf("%s: Got %v, want status %s", target, err, tt.status)
+					}
+				}
+			}
+
+			if failures != tt.failed {
+				t.Errorf("%d of %d targets failed, want %d", failures, len(tt.targets), tt.failed)
+			}
+
+			for _, name := range tt.want {
+				stat, err := os.Stat(filepath.Join(server.Root, filepath.FromSlash(name)))
+				if err != nil {
+					t.Error(err)
+				} else if !stat.IsDir() {
+					t.Errorf("%s is not a directory", name)
+				}
+			}
+		})
+	}
+}
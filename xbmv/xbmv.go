@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+var (
+	verbose bool
+
+	// Named consoles and the default console.
+	config *xbdm.Config
+)
+
+func move(source, dest string) {
+	host, sourcepath, err := config.ParseRemote(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The destination is either a full remote filename on the same host,
+	// which may be given by name or by address, or a path on the source host.
+	destpath := dest
+	if config.IsRemote(dest) {
+		var desthost string
+
+		desthost, destpath, err = config.ParseRemote(dest)
+		if err != nil {
+			log.Fatal(err)
+		} else if !strings.EqualFold(config.Resolve(desthost), config.Resolve(host)) {
+			log.Fatal("Moving between consoles is not supported")
+		}
+	}
+
+	client, err := xbdm.NewDialer(verbose, config).Dial(host)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer client.Close()
+
+	// Move into the destination if it is a directory.
+	if strings.HasSuffix(destpath, string(xbdm.PathSeparator)) {
+		destpath += xbdm.Base(sourcepath)
+	} else if stat, err := client.Stat(destpath); err == nil && stat.IsDir {
+		destpath = xbdm.Join(destpath, xbdm.Base(sourcepath))
+	} else if err != nil && !xbdm.IsStatus(err, xbdm.StatusFileNotFound) {
+		log.Fatal(err)
+	}
+
+	if verbose {
+		log.Printf("Moving %s:\"%s\" to \"%s\"", host, sourcepath, destpath)
+	}
+
+	err = client.Rename(sourcepath, destpath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = client.Quit()
+	if err != nil {
+		log.Fatal("Farewell failed: ", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-v] host:X:\\source [host:]X:\\dest\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func init() {
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+
+	config = xbdm.UserConfig()
+
+	if flag.NArg() != 2 {
+		usage()
+	}
+
+	move(flag.Args()[0], flag.Args()[1])
+}
@@ -1,116 +1,302 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
 )
 
 const (
-	DebugBiosPort  = 731
-	ResponseOk     = "200- OK"
-	ResponseQuit   = "200- bye"
-	ResponseBanner = "201- connected"
-	CommandReboot  = "reboot"
-	ArgumentWarm   = " warm"
-	CommandQuit    = "bye"
-	MessageSuffix  = "\r\n"
+	PollInterval = time.Second
+
+	// Maximum time from the reboot command until the console is seen going
+	// down.
+	DownTimeout = 10 * time.Second
+
+	// Maximum time to wait for the console to halt before launching a title
+	// if -wait is zero.
+	LaunchTimeout = time.Minute
+
+	// Maximum time to wait for the console to come back online unless set
+	// with -wait.
+	DefaultWait = 2 * time.Minute
 )
 
 var (
 	verbose bool
 	cold    bool
+	wait    time.Duration
+	running bool
+	title   string
+	hosts   string
+	workers int
+
+	// Named consoles and the default console.
+	config *xbdm.Config
 )
 
-func connect(host string) (conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, err error) {
-	socket := fmt.Sprintf("%s:%d", host, DebugBiosPort)
+func connect(host string) (*xbdm.Client, error) {
+	return xbdm.NewDialer(verbose, config).Dial(host)
+}
 
-	if verbose {
-		log.Printf("Connecting to %s", socket)
+// Read notifications until one starting with event is received.
+func readUntil(client *xbdm.Client, event string) error {
+	for {
+		line, err := client.ReadNotification()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(line, event) {
+			return nil
+		}
 	}
+}
 
-	conn, err = net.Dial("tcp4", socket)
+// Block until the title is running. The notification channel is opened
+// before asking for the current state, so a title starting in between isn't
+// missed. Debug monitors without getexecstate are only watched for the event.
+func waitRunning(client *xbdm.Client, host string, deadline time.Time) error {
+	notifier, err := connect(host)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
 
-	reader = bufio.NewReader(conn)
-	writer = bufio.NewWriter(conn)
+	defer notifier.Close()
+
+	notifier.SetDeadline(deadline)
 
-	_, err = readResponse(reader, ResponseBanner)
+	err = notifier.Notify()
 	if err != nil {
-		defer conn.Close()
-		return nil, nil, nil, fmt.Errorf("Error reading protocol banner: %s", err)
+		return err
 	}
 
-	return conn, reader, writer, err
+	client.SetDeadline(deadline)
+
+	state, err := client.ExecState()
+	if err == nil && state == xbdm.ExecStateStarted {
+		return nil
+	} else if err != nil && !xbdm.IsStatus(err, xbdm.StatusUnknownCommand) {
+		return err
+	}
+
+	return readUntil(notifier, xbdm.NotificationExecutionStarted)
 }
 
-func readResponse(reader *bufio.Reader, expected string) (response string, err error) {
-	response, err = reader.ReadString('\n')
+// Open a notification channel to watch the console reboot. Debug monitors
+// refusing it are only watched through the control connection.
+func watch(host string) *xbdm.Client {
+	notifier, err := connect(host)
 	if err != nil {
-		return "", err
+		return nil
 	}
 
-	if strings.HasSuffix(response, MessageSuffix) {
-		response = response[:len(response)-len(MessageSuffix)]
+	err = notifier.Notify()
+	if err != nil {
+		notifier.Close()
+		return nil
 	}
 
-	if verbose {
-		log.Printf("Received response \"%s\"", response)
+	return notifier
+}
+
+// Block until the console is seen going down after the reboot command, either
+// by the notification channel reporting it or a connection dropping.
+func waitDown(client, notifier *xbdm.Client, host string, start time.Time) error {
+	deadline := start.Add(DownTimeout)
+	down := make(chan string, 2)
+
+	// Any error but the deadline means the connection dropped.
+	check := func(reason string, err error) {
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			down <- reason
+		}
 	}
 
-	if expected != "" && response != expected {
-		err = fmt.Errorf("Got \"%s\", expected \"%s\".", response, expected)
+	client.SetDeadline(deadline)
+
+	go func() {
+		for {
+			if _, err := client.ReadLine(); err != nil {
+				check("control connection dropped", err)
+				return
+			}
+		}
+	}()
+
+	if notifier != nil {
+		notifier.SetDeadline(deadline)
+
+		go func() {
+			err := readUntil(notifier, xbdm.NotificationExecutionRebooting)
+			if err == nil {
+				down <- "notified"
+			} else {
+				check("notification channel dropped", err)
+			}
+		}()
 	}
 
-	return response, err
+	select {
+	case reason := <-down:
+		if verbose {
+			log.Printf("%s going down, %s", host, reason)
+		}
+
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return fmt.Errorf("%s didn't go down within %s of the reboot command", host, DownTimeout)
+	}
 }
 
-func sendCommand(writer *bufio.Writer, reader *bufio.Reader, command, expected string) (response string, err error) {
+// Connect to a rebooted console once the debug monitor answers again.
+func reconnect(host string, deadline time.Time) (*xbdm.Client, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return xbdm.NewDialer(verbose, config).DialWait(ctx, host, PollInterval)
+}
+
+// Reboot, optionally into the title with magicboot, and wait for the console
+// to go down. Older debug monitors without magicboot are rebooted to halt
+// before the default title starts, then resumed with the title selected.
+func restart(client, notifier *xbdm.Client, host string, start time.Time) error {
+	if title == "" {
+		err := client.Reboot(cold)
+		if err != nil {
+			return err
+		}
+
+		return waitDown(client, notifier, host, start)
+	}
+
+	err := client.MagicBoot(title, true)
+	if err == nil {
+		return waitDown(client, notifier, host, start)
+	} else if !xbdm.IsStatus(err, xbdm.StatusUnknownCommand) {
+		return err
+	}
+
 	if verbose {
-		log.Printf("Sending command \"%s\"", command)
+		log.Printf("Magicboot not supported by %s, selecting title after reboot", host)
+	}
+
+	err = client.RebootWait(cold)
+	if err != nil {
+		return err
+	}
+
+	err = waitDown(client, notifier, host, start)
+	if err != nil {
+		return err
 	}
 
-	_, err = writer.WriteString(command + MessageSuffix)
+	deadline := start.Add(LaunchTimeout)
+	if wait > 0 {
+		deadline = start.Add(wait)
+	}
+
+	halted, err := reconnect(host, deadline)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	err = writer.Flush()
+	defer halted.Close()
+
+	err = halted.SetTitle(title)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return readResponse(reader, expected)
+	return halted.Go()
 }
 
-func reboot(host string) {
-	conn, reader, writer, err := connect(host)
+// Block until the console named name is back online after rebooting at start,
+// or fail when the wait time is exceeded. The reboot duration is printed.
+func waitOnline(host, name string, start time.Time) error {
+	deadline := start.Add(wait)
+
+	if verbose {
+		log.Printf("Waiting up to %s for %s to come back online", wait, host)
+	}
+
+	client, err := reconnect(host, deadline)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer conn.Close()
+	defer client.Close()
+
+	elapsed := time.Since(start)
 
-	command := CommandReboot
+	// Make sure it's the same console answering.
+	if name != "" {
+		client.SetDeadline(deadline)
 
-	if !cold {
-		command += ArgumentWarm
+		after, err := client.DebugName()
+		if err != nil {
+			return err
+		} else if after != name {
+			return fmt.Errorf("%s answered as \"%s\" after reboot, expected \"%s\"", host, after, name)
+		}
 	}
 
-	_, err = sendCommand(writer, reader, command, ResponseOk)
+	fmt.Printf("%s rebooted in %s\n", host, elapsed.Round(time.Millisecond))
+
+	if running {
+		err = waitRunning(client, host, deadline)
+		if err != nil {
+			return fmt.Errorf("Title not running: %w", err)
+		}
+
+		fmt.Printf("%s running title after %s\n", host, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+func reboot(host string) error {
+	client, err := connect(host)
 	if err != nil {
-		log.Fatalf("Command \"%s\" failed: %s", command, err)
+		return err
+	}
+
+	defer client.Close()
+
+	// The name is compared after rebooting if supported.
+	name, err := client.DebugName()
+	if err != nil && !xbdm.IsStatus(err, xbdm.StatusUnknownCommand) {
+		return err
+	}
+
+	notifier := watch(host)
+	if notifier != nil {
+		defer notifier.Close()
 	}
+
+	start := time.Now()
+
+	err = restart(client, notifier, host, start)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return waitOnline(host, name, start)
+	}
+
+	return nil
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [-cold] [-v] host\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [-cold] [-launch X:\\path\\default.xbe] [-wait duration [-running]] [-hosts file] [-j workers] [-v] [host...]\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -118,15 +304,48 @@ func usage() {
 func init() {
 	flag.BoolVar(&verbose, "v", false, "verbose")
 	flag.BoolVar(&cold, "cold", false, "reload BIOS")
+	flag.StringVar(&title, "launch", "", "reboot into title")
+	flag.DurationVar(&wait, "wait", DefaultWait, "wait until the console is back online, exit with error after duration, 0 to not wait")
+	flag.BoolVar(&running, "running", false, "also wait until the title is running, requires -wait above 0")
+	flag.StringVar(&hosts, "hosts", "", "file listing hosts to reboot, one per line")
+	flag.IntVar(&workers, "j", xbdm.DefaultWorkers, "maximum number of consoles rebooted concurrently")
 	flag.Usage = usage
 }
 
 func main() {
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	config = xbdm.UserConfig()
+
+	targets := flag.Args()
+
+	if hosts != "" {
+		list, err := xbdm.ReadHosts(hosts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		targets = append(targets, list...)
+	}
+
+	if len(targets) == 0 && config.DefaultConsole() != "" {
+		targets = []string{config.DefaultConsole()}
+	}
+
+	if len(targets) == 0 || (running && wait == 0) {
 		usage()
 	}
 
-	reboot(flag.Args()[0])
+	results := xbdm.FanOut(targets, workers, reboot)
+
+	// A single console fails like the other tools, without a table.
+	if len(results) > 1 {
+		xbdm.WriteResults(os.Stdout, results)
+	} else if results[0].Err != nil {
+		log.Print(results[0].Err)
+	}
+
+	if xbdm.Failed(results) > 0 {
+		os.Exit(1)
+	}
 }
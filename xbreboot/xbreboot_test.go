@@ -0,0 +1,218 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+const testTitle = `E:\Games\Halo\default.xbe`
+
+func newServer(t *testing.T) *xbdmtest.Server {
+	t.Helper()
+
+	server, err := xbdmtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+// Report whether a command named name was received.
+func received(server *xbdmtest.Server, name string) bool {
+	for _, line := range server.Commands() {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.EqualFold(fields[0], name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Answer dbgname with first before the reboot and then with later.
+func renamed(first, later string) xbdmtest.Handler {
+	var calls atomic.Int32
+
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		if calls.Add(1) == 1 {
+			c.Respond(xbdm.StatusOK, first)
+		} else {
+			c.Respond(xbdm.StatusOK, later)
+		}
+	}
+}
+
+func TestReboot(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(s *xbdmtest.Server)
+		wait    time.Duration
+		running bool
+		title   string
+		want    []string
+		status  xbdm.Status
+		err     bool
+	}{
+		{name: "no wait", want: []string{"reboot"}},
+		{name: "wait", wait: 5 * time.Second, want: []string{"reboot", "dbgname"}},
+		{name: "running", wait: 5 * time.Second, running: true, want: []string{"reboot", "getexecstate"}},
+		{
+			// The title started before the notification channel was opened.
+			name: "running without event", wait: 5 * time.Second, running: true, want: []string{"getexecstate"},
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("reboot", func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+					c.Respond(xbdm.StatusOK, "OK")
+					c.Close()
+				})
+			},
+		},
+		{name: "magicboot", title: testTitle, wait: 5 * time.Second, running: true, want: []string{"magicboot"}},
+		{
+			name: "magicboot unsupported", title: testTitle, wait: 5 * time.Second, running: true,
+			want: []string{"magicboot", "reboot", "title", "go"},
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("magicboot", xbdmtest.Respond(xbdm.StatusUnknownCommand, "unknown command"))
+			},
+		},
+		{
+			name: "title not started", title: testTitle, wait: 1500 * time.Millisecond, running: true, err: true,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("magicboot", xbdmtest.Respond(xbdm.StatusUnknownCommand, "unknown command"))
+				s.Handle("go", xbdmtest.Respond(xbdm.StatusOK, "OK"))
+			},
+		},
+		{
+			name: "dbgname unsupported", wait: 5 * time.Second, want: []string{"reboot"},
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("dbgname", xbdmtest.Respond(xbdm.StatusUnknownCommand, "unknown command"))
+			},
+		},
+		{
+			name: "different console", wait: 5 * time.Second, err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("dbgname", renamed("before", "after")) },
+		},
+		{
+			name: "reboot refused", status: xbdm.StatusAccessDenied,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("reboot", xbdmtest.Respond(xbdm.StatusAccessDenied, "access denied"))
+			},
+		},
+		{
+			name: "hangup", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("dbgname", xbdmtest.Hangup()) },
+		},
+		{
+			name: "malformed response", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("dbgname", xbdmtest.Raw("200 OK\r\n")) },
+		},
+		{
+			name: "malformed banner", err: true,
+			setup: func(s *xbdmtest.Server) { s.SetBanner("hello") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verbose, cold, config = false, false, nil
+			wait, running, title = tt.wait, tt.running, tt.title
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			err := reboot(server.Addr())
+
+			if tt.err || tt.status != 0 {
+				if err == nil {
+					t.Fatal("Reboot succeeded, want error")
+				} else if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+					t.Errorf("Got %v, want status %s", err, tt.status)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !received(server, want) {
+					t.Errorf("Commands %q don't include %s", server.Commands(), want)
+				}
+			}
+
+			if tt.title != "" && server.Title() != tt.title {
+				t.Errorf("Launched \"%s\", want \"%s\"", server.Title(), tt.title)
+			}
+		})
+	}
+}
+
+// Run f and return what it printed to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+
+	f()
+	w.Close()
+
+	return string(<-output)
+}
+
+func TestRebootOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(s *xbdmtest.Server)
+		rebooted bool
+	}{
+		{name: "same console", rebooted: true},
+		{
+			name:  "different console",
+			setup: func(s *xbdmtest.Server) { s.Handle("dbgname", renamed("before", "after")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verbose, cold, config = false, false, nil
+			wait, running, title = 5*time.Second, false, ""
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			output := captureStdout(t, func() { reboot(server.Addr()) })
+
+			if strings.Contains(output, "rebooted in") != tt.rebooted {
+				t.Errorf("Printed %q, want rebooted %t", output, tt.rebooted)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dstien/dutils/xbdm"
+)
+
+var (
+	verbose   bool
+	recursive bool
+	force     bool
+
+	// Connections are kept open for all targets.
+	pool   xbdm.Pool
+	failed int
+
+	// Named consoles and the default console.
+	config *xbdm.Config
+)
+
+func remove(target string) error {
+	host, path, err := config.ParseRemote(target)
+	if err != nil {
+		return err
+	}
+
+	// Like rm preserving /, never walk a whole partition.
+	if xbdm.IsRoot(path) {
+		return fmt.Errorf("Refusing to remove drive root %s:\"%s\"", host, path)
+	}
+
+	client, err := pool.Client(host)
+	if err != nil {
+		return err
+	}
+
+	stat, err := client.Stat(path)
+	if err != nil {
+		if force && xbdm.IsStatus(err, xbdm.StatusFileNotFound) {
+			return nil
+		}
+
+		pool.Check(host, err)
+		return err
+	}
+
+	if stat.IsDir {
+		if !recursive {
+			return fmt.Errorf("Cannot remove %s:\"%s\": Is a directory, use -r to remove recursively", host, path)
+		}
+
+		if verbose {
+			log.Printf("Removing directory %s:\"%s\" recursively", host, path)
+		}
+
+		err = client.RemoveAll(path)
+	} else {
+		if verbose {
+			log.Printf("Removing %s:\"%s\"", host, path)
+		}
+
+		err = client.Delete(path, false)
+	}
+
+	if err != nil {
+		pool.Check(host, err)
+	}
+
+	return err
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-r] [-f] [-v] host:X:\\path...\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func init() {
+	flag.BoolVar(&verbose, "v", false, "verbose")
+	flag.BoolVar(&recursive, "r", false, "remove directories and their contents recursively")
+	flag.BoolVar(&force, "f", false, "ignore nonexistent files")
+	flag.Usage = usage
+}
+
+func main() {
+	flag.Parse()
+
+	config = xbdm.UserConfig()
+
+	pool.Dialer = xbdm.NewDialer(verbose, config)
+
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	for _, target := range flag.Args() {
+		err := remove(target)
+		if err != nil {
+			failed++
+			log.Print(err)
+		}
+	}
+
+	err := pool.Quit()
+	if err != nil {
+		log.Print(err)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
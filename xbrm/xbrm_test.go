@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+// Start a fake console with a few files on the E drive and a fresh
+// connection pool.
+func newServer(t *testing.T) *xbdmtest.Server {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, name := range []string{"E/a.txt", "E/b.txt", "E/dir/c.txt", "E/dir/sub/d.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err == nil {
+			err = os.WriteFile(path, []byte(name), 0666)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := xbdmtest.NewServer(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = xbdm.Pool{}
+
+	t.Cleanup(func() {
+		pool.Quit()
+		server.Close()
+	})
+
+	return server
+}
+
+// Hang up on the first command, then serve the rest with handler.
+func hangupOnce(handler xbdmtest.Handler) xbdmtest.Handler {
+	var calls atomic.Int32
+
+	return func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+		if calls.Add(1) == 1 {
+			c.Close()
+			return
+		}
+
+		handler(c, cmd)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name      string
+		targets   []string
+		recursive bool
+		force     bool
+		setup     func(s *xbdmtest.Server)
+		removed   []string
+		kept      []string
+		failed    int
+		status    xbdm.Status
+	}{
+		{name: "file", targets: []string{`E:\a.txt`}, removed: []string{"E/a.txt"}, kept: []string{"E/b.txt"}},
+		{name: "several", targets: []string{`E:\a.txt`, `E:\b.txt`}, removed: []string{"E/a.txt", "E/b.txt"}},
+		{name: "directory", targets: []string{`E:\dir`}, kept: []string{"E/dir/sub/d.txt"}, failed: 1},
+		{
+			name: "recursive", targets: []string{`E:\dir`}, recursive: true,
+			removed: []string{"E/dir"}, kept: []string{"E/a.txt"},
+		},
+		{
+			name: "recursive file", targets: []string{`E:\a.txt`}, recursive: true,
+			removed: []string{"E/a.txt"},
+		},
+		{name: "missing", targets: []string{`E:\missing.txt`}, failed: 1, status: xbdm.StatusFileNotFound},
+		{name: "force missing", targets: []string{`E:\missing.txt`, `E:\a.txt`}, force: true, removed: []string{"E/a.txt"}},
+		{
+			name: "drive root", targets: []string{`E:\`, `E:`, `e:\`}, recursive: true, force: true,
+			kept: []string{"E/a.txt", "E/dir/sub/d.txt"}, failed: 3,
+		},
+		{
+			name: "refused", targets: []string{`E:\a.txt`}, failed: 1, status: xbdm.StatusAccessDenied,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("delete", xbdmtest.Respond(xbdm.StatusAccessDenied, "access denied"))
+			},
+			kept: []string{"E/a.txt"},
+		},
+		{
+			name: "recursive failure", targets: []string{`E:\dir`}, recursive: true, failed: 1,
+			setup: func(s *xbdmtest.Server) { s.Handle("dirlist", xbdmtest.Hangup()) },
+			kept:  []string{"E/dir/sub/d.txt"},
+		},
+		{
+			// The dropped connection is replaced for the next target.
+			name: "redial", targets: []string{`E:\a.txt`, `E:\b.txt`}, failed: 1,
+			setup: func(s *xbdmtest.Server) { s.Handle("delete", hangupOnce(s.Handler("delete"))) },
+			kept:  []string{"E/a.txt"}, removed: []string{"E/b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verbose, recursive, force, config = false, tt.recursive, tt.force, nil
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			failures := 0
+
+			for _, target := range tt.targets {
+				err := remove(server.Addr() + ":" + target)
+				if err != nil {
+					failures++
+
+					if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+						t.Errorf("%s: Got %v, want status %s", target, err, tt.status)
+					}
+				}
+			}
+
+			if failures != tt.failed {
+				t.Errorf("%d of %d targets failed, want %d", failures, len(tt.targets), tt.failed)
+			}
+
+			for _, name := range tt.removed {
+				if _, err := os.Stat(filepath.Join(server.Root, filepath.FromSlash(name))); !os.IsNotExist(err) {
+					t.Errorf("%s not removed", name)
+				}
+			}
+
+			for _, name := range tt.kept {
+				if _, err := os.Stat(filepath.Join(server.Root, filepath.FromSlash(name))); err != nil {
+					t.Errorf("%s not kept: %v", name, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+const (
+	PNGSignature = "\x89PNG\r\n\x1a\n"
+)
+
+// Display time of each frame from the capture times. The last frame is shown
+// for the requested interval, or as long as the one before it.
+func frameDelays(times []time.Time) []time.Duration {
+	delays := make([]time.Duration, len(times))
+
+	for i := 0; i < len(times)-1; i++ {
+		delays[i] = times[i+1].Sub(times[i])
+	}
+
+	if last := len(delays) - 1; interval > 0 || last == 0 {
+		delays[last] = interval
+	} else {
+		delays[last] = delays[last-1]
+	}
+
+	return delays
+}
+
+func writeAnimation(frames []image.Image, delays []time.Duration, name string) error {
+	return writeOutput(name, func(w io.Writer) error {
+		if encoding == GIF {
+			return encodeGIF(w, frames, delays)
+		}
+
+		return encodeAPNG(w, frames, delays)
+	})
+}
+
+// Quantise each frame to the Plan 9 palette with Floyd-Steinberg dithering.
+func encodeGIF(w io.Writer, frames []image.Image, delays []time.Duration) error {
+	anim := &gif.GIF{}
+
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, frame, bounds.Min)
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, int(delays[i]/(10*time.Millisecond)))
+	}
+
+	return gif.EncodeAll(w, anim)
+}
+
+// APNG is written directly as image/png can't encode animations. All frames
+// are stored as 8 bit RGBA with the same dimensions.
+type apngWriter struct {
+	w   io.Writer
+	err error
+	seq uint32
+}
+
+func (a *apngWriter) chunk(kind string, data []byte) {
+	if a.err != nil {
+		return
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], kind)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, p := range [][]byte{header, data, footer} {
+		if _, err := a.w.Write(p); err != nil {
+			a.err = err
+			return
+		}
+	}
+}
+
+// Chunk data prefixed with the next sequence number.
+func (a *apngWriter) sequenced(data ...[]byte) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, a.seq)
+	a.seq++
+
+	for _, p := range data {
+		buf = append(buf, p...)
+	}
+
+	return buf
+}
+
+func (a *apngWriter) frameControl(bounds image.Rectangle, delay time.Duration) {
+	ms := delay / time.Millisecond
+	if ms > 0xffff {
+		ms = 0xffff
+	}
+
+	data := make([]byte, 22)
+	binary.BigEndian.PutUint32(data[0:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(data[4:], uint32(bounds.Dy()))
+	// Offset is zero, dispose and blend operations are none and source.
+	binary.BigEndian.PutUint16(data[16:], uint16(ms))
+	binary.BigEndian.PutUint16(data[18:], 1000)
+
+	a.chunk("fcTL", a.sequenced(data))
+}
+
+// Compress rows of RGBA pixels, each filtered as the difference to the row
+// above.
+func compressFrame(frame image.Image) ([]byte, error) {
+	bounds := frame.Bounds()
+
+	img, ok := frame.(*image.NRGBA)
+	if !ok {
+		img = image.NewNRGBA(bounds)
+		draw.Draw(img, bounds, frame, bounds.Min, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+
+	width := bounds.Dx() * 4
+	row := make([]byte, 1+width)
+	prev := make([]byte, width)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(bounds.Min.X, y):][:width]
+
+		row[0] = 2
+		for i := range pix {
+			row[1+i] = pix[i] - prev[i]
+		}
+
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+
+		prev = pix
+	}
+
+	err := zw.Close()
+
+	return buf.Bytes(), err
+}
+
+func encodeAPNG(w io.Writer, frames []image.Image, delays []time.Duration) error {
+	bounds := frames[0].Bounds()
+	a := &apngWriter{w: w}
+
+	if _, err := io.WriteString(w, PNGSignature); err != nil {
+		return err
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(bounds.Dy()))
+	header[8] = 8 // Bit depth
+	header[9] = 6 // Truecolour with alpha
+	a.chunk("IHDR", header)
+
+	// Number of frames, followed by zero for infinite looping.
+	control := make([]byte, 8)
+	binary.BigEndian.PutUint32(control, uint32(len(frames)))
+	a.chunk("acTL", control)
+
+	for i, frame := range frames {
+		if frame.Bounds().Size() != bounds.Size() {
+			return fmt.Errorf("Frame %d is %dx%d, expected %dx%d", i+1, frame.Bounds().Dx(), frame.Bounds().Dy(), bounds.Dx(), bounds.Dy())
+		}
+
+		data, err := compressFrame(frame)
+		if err != nil {
+			return err
+		}
+
+		a.frameControl(bounds, delays[i])
+
+		// The first frame is also the default image.
+		if i == 0 {
+			a.chunk("IDAT", data)
+		} else {
+			a.chunk("fdAT", a.sequenced(data))
+		}
+	}
+
+	a.chunk("IEND", nil)
+
+	return a.err
+}
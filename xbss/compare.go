@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+)
+
+// Comparison of a screenshot to a reference image. Only the colour channels
+// are compared, alpha is ignored.
+type Comparison struct {
+	Pixels     int
+	Mismatched int
+	PSNR       float64
+	Diff       *image.NRGBA
+}
+
+func (c *Comparison) String() string {
+	return fmt.Sprintf("%d of %d pixels mismatched (%.2f%%), PSNR %.2f dB", c.Mismatched, c.Pixels, c.MismatchedPercent(), c.PSNR)
+}
+
+func (c *Comparison) MismatchedPercent() float64 {
+	return float64(c.Mismatched) * 100 / float64(c.Pixels)
+}
+
+func loadImage(name string) (image.Image, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't decode \"%s\": %w", name, err)
+	}
+
+	return img, nil
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+
+	return int(b - a)
+}
+
+// Compare img to golden pixel by pixel. A pixel is mismatched if any channel
+// differs by more than tolerance. The diff image shows mismatched pixels in
+// red over a dimmed grayscale copy of the screenshot.
+func compareImages(img, golden image.Image, tolerance int) (*Comparison, error) {
+	bounds, goldenBounds := img.Bounds(), golden.Bounds()
+
+	if bounds.Size() != goldenBounds.Size() {
+		return nil, fmt.Errorf("Image is %dx%d, reference is %dx%d", bounds.Dx(), bounds.Dy(), goldenBounds.Dx(), goldenBounds.Dy())
+	}
+
+	c := &Comparison{
+		Pixels: bounds.Dx() * bounds.Dy(),
+		Diff:   image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy())),
+	}
+
+	var squared float64
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			p := toNRGBA(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			g := toNRGBA(golden.At(goldenBounds.Min.X+x, goldenBounds.Min.Y+y))
+
+			mismatched := false
+
+			for _, d := range []int{absDiff(p.R, g.R), absDiff(p.G, g.G), absDiff(p.B, g.B)} {
+				squared += float64(d * d)
+				mismatched = mismatched || d > tolerance
+			}
+
+			if mismatched {
+				c.Mismatched++
+				c.Diff.SetNRGBA(x, y, color.NRGBA{0xff, 0, 0, 0xff})
+			} else {
+				gray := uint8((299*int(p.R) + 587*int(p.G) + 114*int(p.B)) / 1000 / 3)
+				c.Diff.SetNRGBA(x, y, color.NRGBA{gray, gray, gray, 0xff})
+			}
+		}
+	}
+
+	// Identical images have infinite PSNR.
+	mse := squared / float64(c.Pixels*3)
+	c.PSNR = 10 * math.Log10(255*255/mse)
+
+	return c, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+type Encoding int
+
+const (
+	Auto Encoding = iota
+	PNG
+	JPEG
+	GIF
+	APNG
+	BGRA
+	PPM
+)
+
+var encodingStrings = []string{
+	Auto: "Auto",
+	PNG:  "PNG",
+	JPEG: "JPEG",
+	GIF:  "GIF",
+	APNG: "APNG",
+	BGRA: "BGRA",
+	PPM:  "PPM",
+}
+
+// Filename extensions of each encoding, the first being the default.
+var encodingExtensions = map[Encoding][]string{
+	PNG:  {".png"},
+	JPEG: {".jpg", ".jpeg"},
+	GIF:  {".gif"},
+	APNG: {".apng"},
+	BGRA: {".bgra", ".raw"},
+	PPM:  {".ppm"},
+}
+
+func (e Encoding) String() string {
+	return encodingStrings[e]
+}
+
+func (e *Encoding) Set(value string) error {
+	for encoding, name := range encodingStrings {
+		if strings.EqualFold(strings.TrimSpace(value), name) {
+			*e = Encoding(encoding)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Invalid image format. Got \"%s\", expected one of %s", value, encodingList())
+}
+
+func encodingList() string {
+	return fmt.Sprintf("\"%s\"", strings.Join(encodingStrings, "\", \""))
+}
+
+// Resolve Auto from the extension of the output filename, defaulting to PNG.
+func (e Encoding) resolve(name string) Encoding {
+	if e != Auto {
+		return e
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+
+	for encoding, extensions := range encodingExtensions {
+		for _, extension := range extensions {
+			if ext == extension {
+				return encoding
+			}
+		}
+	}
+
+	return PNG
+}
+
+func (e Encoding) extension() string {
+	return encodingExtensions[e][0]
+}
+
+func (e Encoding) isAnimation() bool {
+	return e == GIF || e == APNG
+}
+
+func toNRGBA(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+// Pixels are written top to bottom without padding, 4 bytes per pixel in
+// B, G, R, A order.
+func encodeBGRA(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	row := make([]byte, 0, bounds.Dx()*4)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := toNRGBA(img.At(x, y))
+			row = append(row, c.B, c.G, c.R, c.A)
+		}
+
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Binary portable pixmap, alpha is discarded.
+func encodePPM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	row := make([]byte, 0, bounds.Dx()*3)
+
+	if _, err := fmt.Fprintf(w, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := toNRGBA(img.At(x, y))
+			row = append(row, c.R, c.G, c.B)
+		}
+
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeImage(w io.Writer, img image.Image, encoding Encoding) error {
+	switch encoding {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case BGRA:
+		return encodeBGRA(w, img)
+	case PPM:
+		return encodePPM(w, img)
+	}
+
+	return png.Encode(w, img)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Format describes how pixels of an Xbox D3DFORMAT are stored.
+type Format struct {
+	Name          string
+	BytesPerPixel int
+	Swizzled      bool
+	Decode        func(p []byte) color.NRGBA
+}
+
+// Framebuffer formats reported by the screenshot command, keyed by D3DFORMAT.
+var formats = map[int]Format{
+	0x02: {"A1R5G5B5", 2, true, decodeA1R5G5B5},
+	0x03: {"X1R5G5B5", 2, true, decodeX1R5G5B5},
+	0x04: {"A4R4G4B4", 2, true, decodeA4R4G4B4},
+	0x05: {"R5G6B5", 2, true, decodeR5G6B5},
+	0x06: {"A8R8G8B8", 4, true, decodeA8R8G8B8},
+	0x07: {"X8R8G8B8", 4, true, decodeX8R8G8B8},
+	0x10: {"LIN_A1R5G5B5", 2, false, decodeA1R5G5B5},
+	0x11: {"LIN_R5G6B5", 2, false, decodeR5G6B5},
+	0x12: {"LIN_A8R8G8B8", 4, false, decodeA8R8G8B8},
+	0x1c: {"LIN_X1R5G5B5", 2, false, decodeX1R5G5B5},
+	0x1d: {"LIN_A4R4G4B4", 2, false, decodeA4R4G4B4},
+	0x1e: {"LIN_X8R8G8B8", 4, false, decodeX8R8G8B8},
+	0x3a: {"A8B8G8R8", 4, true, decodeA8B8G8R8},
+	0x3b: {"B8G8R8A8", 4, true, decodeB8G8R8A8},
+	0x3c: {"R8G8B8A8", 4, true, decodeR8G8B8A8},
+	0x3f: {"LIN_A8B8G8R8", 4, false, decodeA8B8G8R8},
+	0x40: {"LIN_B8G8R8A8", 4, false, decodeB8G8R8A8},
+	0x41: {"LIN_R8G8B8A8", 4, false, decodeR8G8B8A8},
+}
+
+// Scale a channel of the given bit depth to 8 bits.
+func expand(value uint16, bits uint) uint8 {
+	max := uint16(1)<<bits - 1
+	return uint8((uint32(value&max)*255 + uint32(max)/2) / uint32(max))
+}
+
+func decodeA1R5G5B5(p []byte) color.NRGBA {
+	v := binary.LittleEndian.Uint16(p)
+	return color.NRGBA{expand(v>>10, 5), expand(v>>5, 5), expand(v, 5), expand(v>>15, 1)}
+}
+
+func decodeX1R5G5B5(p []byte) color.NRGBA {
+	c := decodeA1R5G5B5(p)
+	c.A = 0xff
+	return c
+}
+
+func decodeA4R4G4B4(p []byte) color.NRGBA {
+	v := binary.LittleEndian.Uint16(p)
+	return color.NRGBA{expand(v>>8, 4), expand(v>>4, 4), expand(v, 4), expand(v>>12, 4)}
+}
+
+func decodeR5G6B5(p []byte) color.NRGBA {
+	v := binary.LittleEndian.Uint16(p)
+	return color.NRGBA{expand(v>>11, 5), expand(v>>5, 6), expand(v, 5), 0xff}
+}
+
+// 32 bit formats are named from the most significant byte of a little endian
+// word, so A8R8G8B8 is stored as B, G, R, A in memory.
+func decodeA8R8G8B8(p []byte) color.NRGBA {
+	return color.NRGBA{p[2], p[1], p[0], p[3]}
+}
+
+func decodeX8R8G8B8(p []byte) color.NRGBA {
+	return color.NRGBA{p[2], p[1], p[0], 0xff}
+}
+
+func decodeA8B8G8R8(p []byte) color.NRGBA {
+	return color.NRGBA{p[0], p[1], p[2], p[3]}
+}
+
+func decodeB8G8R8A8(p []byte) color.NRGBA {
+	return color.NRGBA{p[1], p[2], p[3], p[0]}
+}
+
+func decodeR8G8B8A8(p []byte) color.NRGBA {
+	return color.NRGBA{p[3], p[2], p[1], p[0]}
+}
+
+// Offset of pixel (x, y) in a swizzled surface, where the bits of the
+// coordinates are interleaved starting with x.
+func swizzleOffset(x, y, width, height int) int {
+	offset, bit := 0, uint(0)
+
+	for i := uint(0); 1<<i < width || 1<<i < height; i++ {
+		if 1<<i < width {
+			offset |= (x >> i & 1) << bit
+			bit++
+		}
+
+		if 1<<i < height {
+			offset |= (y >> i & 1) << bit
+			bit++
+		}
+	}
+
+	return offset
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// Convert a raw framebuffer to an image. Rows of linear formats are pitch
+// bytes apart, which may include padding beyond the visible width. Alpha is
+// discarded if opaque is set.
+func decodeImage(data []byte, pitch, width, height, code int, opaque bool) (*image.NRGBA, error) {
+	format, ok := formats[code]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported image format 0x%x", code)
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("Invalid image dimensions %dx%d", width, height)
+	}
+
+	bpp := format.BytesPerPixel
+	size := pitch*(height-1) + width*bpp
+
+	if format.Swizzled {
+		if !isPowerOfTwo(width) || !isPowerOfTwo(height) {
+			return nil, fmt.Errorf("Swizzled %s image dimensions %dx%d are not powers of two", format.Name, width, height)
+		}
+
+		size = width * height * bpp
+	} else if pitch < width*bpp {
+		return nil, fmt.Errorf("Pitch %d too small for %d pixels wide %s image", pitch, width, format.Name)
+	}
+
+	if len(data) < size {
+		return nil, fmt.Errorf("Framebuffer size %d too small for %dx%d %s image, expected %d", len(data), width, height, format.Name, size)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := y*pitch + x*bpp
+
+			if format.Swizzled {
+				offset = swizzleOffset(x, y, width, height) * bpp
+			}
+
+			c := format.Decode(data[offset : offset+bpp])
+
+			if opaque {
+				c.A = 0xff
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
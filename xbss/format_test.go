@@ -0,0 +1,209 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestDecodeFormats(t *testing.T) {
+	tests := []struct {
+		code  int
+		pixel []byte
+		want  color.NRGBA
+	}{
+		// A=1, R=31, G=0, B=16.
+		{0x02, []byte{0x10, 0xfc}, color.NRGBA{255, 0, 132, 255}},
+		{0x10, []byte{0x10, 0xfc}, color.NRGBA{255, 0, 132, 255}},
+		// Unused top bit clear, still opaque.
+		{0x03, []byte{0x10, 0x7c}, color.NRGBA{255, 0, 132, 255}},
+		{0x1c, []byte{0x10, 0x7c}, color.NRGBA{255, 0, 132, 255}},
+		// A=8, R=15, G=0, B=10.
+		{0x04, []byte{0x0a, 0x8f}, color.NRGBA{255, 0, 170, 136}},
+		{0x1d, []byte{0x0a, 0x8f}, color.NRGBA{255, 0, 170, 136}},
+		// R=31, G=32, B=0.
+		{0x05, []byte{0x00, 0xfc}, color.NRGBA{255, 130, 0, 255}},
+		{0x11, []byte{0x00, 0xfc}, color.NRGBA{255, 130, 0, 255}},
+		// 32 bit formats are stored least significant byte first.
+		{0x06, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x33, 0x22, 0x11, 0x44}},
+		{0x12, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x33, 0x22, 0x11, 0x44}},
+		{0x07, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x33, 0x22, 0x11, 0xff}},
+		{0x1e, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x33, 0x22, 0x11, 0xff}},
+		{0x3a, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{0x3f, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{0x3b, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x22, 0x33, 0x44, 0x11}},
+		{0x40, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x22, 0x33, 0x44, 0x11}},
+		{0x3c, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x44, 0x33, 0x22, 0x11}},
+		{0x41, []byte{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x44, 0x33, 0x22, 0x11}},
+	}
+
+	tested := map[int]bool{}
+
+	for _, tt := range tests {
+		tested[tt.code] = true
+
+		format := formats[tt.code]
+
+		if len(tt.pixel) != format.BytesPerPixel {
+			t.Errorf("%s: Test pixel is %d bytes, expected %d", format.Name, len(tt.pixel), format.BytesPerPixel)
+			continue
+		}
+
+		img, err := decodeImage(tt.pixel, len(tt.pixel), 1, 1, tt.code, false)
+		if err != nil {
+			t.Errorf("%s: %v", format.Name, err)
+		} else if got := img.NRGBAAt(0, 0); got != tt.want {
+			t.Errorf("%s: Decoded %v, want %v", format.Name, got, tt.want)
+		}
+	}
+
+	for code, format := range formats {
+		if !tested[code] {
+			t.Errorf("Format 0x%02x %s not tested", code, format.Name)
+		}
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	// Two 2x2 LIN_A8R8G8B8 rows with 4 bytes of padding each.
+	padded := []byte{
+		0x01, 0x02, 0x03, 0x80, 0x04, 0x05, 0x06, 0x80, 0xee, 0xee, 0xee, 0xee,
+		0x07, 0x08, 0x09, 0x80, 0x0a, 0x0b, 0x0c, 0x80, 0xee, 0xee, 0xee, 0xee,
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		pitch  int
+		width  int
+		height int
+		code   int
+		opaque bool
+		want   map[[2]int]color.NRGBA
+		err    bool
+	}{
+		{
+			name: "row padding", data: padded, pitch: 12, width: 2, height: 2, code: 0x12,
+			want: map[[2]int]color.NRGBA{
+				{0, 0}: {0x03, 0x02, 0x01, 0x80},
+				{1, 0}: {0x06, 0x05, 0x04, 0x80},
+				{0, 1}: {0x09, 0x08, 0x07, 0x80},
+				{1, 1}: {0x0c, 0x0b, 0x0a, 0x80},
+			},
+		},
+		{
+			// The padding after the last row may be left out.
+			name: "unpadded last row", data: padded[:20], pitch: 12, width: 2, height: 2, code: 0x12,
+			want: map[[2]int]color.NRGBA{{1, 1}: {0x0c, 0x0b, 0x0a, 0x80}},
+		},
+		{
+			name: "opaque", data: padded, pitch: 12, width: 2, height: 2, code: 0x12, opaque: true,
+			want: map[[2]int]color.NRGBA{{1, 1}: {0x0c, 0x0b, 0x0a, 0xff}},
+		},
+		{
+			name: "opaque 16 bit", data: []byte{0x10, 0x7c}, pitch: 2, width: 1, height: 1, code: 0x02, opaque: true,
+			want: map[[2]int]color.NRGBA{{0, 0}: {255, 0, 132, 255}},
+		},
+		{name: "pitch too small", data: padded, pitch: 4, width: 2, height: 2, code: 0x12, err: true},
+		{name: "truncated", data: padded[:19], pitch: 12, width: 2, height: 2, code: 0x12, err: true},
+		{name: "truncated swizzled", data: make([]byte, 31), pitch: 16, width: 4, height: 2, code: 0x06, err: true},
+		{name: "swizzled not power of two", data: make([]byte, 24), pitch: 12, width: 3, height: 2, code: 0x06, err: true},
+		{name: "zero width", data: padded, pitch: 12, width: 0, height: 2, code: 0x12, err: true},
+		{name: "unsupported format", data: padded, pitch: 12, width: 2, height: 2, code: 0x99, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodeImage(tt.data, tt.pitch, tt.width, tt.height, tt.code, tt.opaque)
+
+			if tt.err {
+				if err == nil {
+					t.Fatal("Decoding succeeded, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for p, want := range tt.want {
+				if got := img.NRGBAAt(p[0], p[1]); got != want {
+					t.Errorf("Pixel %v = %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSwizzleOffset(t *testing.T) {
+	tests := []struct {
+		x, y, width, height int
+		want                int
+	}{
+		// Square surfaces interleave x and y bits, starting with x.
+		{1, 0, 4, 4, 1},
+		{0, 1, 4, 4, 2},
+		{2, 0, 4, 4, 4},
+		{3, 3, 4, 4, 15},
+		// Once the smaller dimension runs out of bits, the rest are taken
+		// from the larger one.
+		{1, 0, 4, 2, 1},
+		{0, 1, 4, 2, 2},
+		{2, 0, 4, 2, 4},
+		{3, 1, 4, 2, 7},
+		{0, 2, 2, 4, 4},
+		{1, 3, 2, 4, 7},
+		{7, 0, 8, 2, 13},
+	}
+
+	for _, tt := range tests {
+		if got := swizzleOffset(tt.x, tt.y, tt.width, tt.height); got != tt.want {
+			t.Errorf("swizzleOffset(%d, %d, %d, %d) = %d, want %d", tt.x, tt.y, tt.width, tt.height, got, tt.want)
+		}
+	}
+
+	// Every pixel of a non-square surface maps to a distinct offset.
+	for _, size := range [][2]int{{8, 4}, {4, 8}, {16, 2}, {1, 8}} {
+		width, height := size[0], size[1]
+		seen := map[int]bool{}
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				offset := swizzleOffset(x, y, width, height)
+
+				if offset < 0 || offset >= width*height || seen[offset] {
+					t.Errorf("%dx%d: Offset %d of (%d, %d) out of range or repeated", width, height, offset, x, y)
+				}
+
+				seen[offset] = true
+			}
+		}
+	}
+}
+
+func TestDecodeSwizzled(t *testing.T) {
+	const width, height = 8, 4
+
+	// Store each pixel's linear index in its blue channel.
+	data := make([]byte, width*height*4)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			data[swizzleOffset(x, y, width, height)*4] = byte(y*width + x)
+		}
+	}
+
+	img, err := decodeImage(data, width*4, width, height, 0x07, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got := img.NRGBAAt(x, y).B; got != byte(y*width+x) {
+				t.Errorf("Pixel (%d, %d) has index %d", x, y, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Aspect is a display aspect ratio, set as "W:H" or a decimal number. Zero
+// keeps the aspect ratio of the framebuffer.
+type Aspect float64
+
+func (a Aspect) String() string {
+	switch {
+	case a == 0:
+		return ""
+	case math.Abs(float64(a)-4.0/3.0) < 1e-9:
+		return "4:3"
+	case math.Abs(float64(a)-16.0/9.0) < 1e-9:
+		return "16:9"
+	}
+
+	return strconv.FormatFloat(float64(a), 'g', -1, 64)
+}
+
+func (a *Aspect) Set(value string) error {
+	var ratio float64
+	var err error
+
+	if parts := strings.SplitN(strings.TrimSpace(value), ":", 2); len(parts) == 2 {
+		var width, height float64
+
+		width, err = strconv.ParseFloat(parts[0], 64)
+		if err == nil {
+			height, err = strconv.ParseFloat(parts[1], 64)
+			ratio = width / height
+		}
+	} else {
+		ratio, err = strconv.ParseFloat(value, 64)
+	}
+
+	if err != nil || !(ratio > 0) || math.IsInf(ratio, 0) {
+		return fmt.Errorf("Invalid aspect ratio. Got \"%s\", expected e.g. \"4:3\" or \"16:9\"", value)
+	}
+
+	*a = Aspect(ratio)
+
+	return nil
+}
+
+// Size of the output image. The width is adjusted to the display aspect ratio
+// before both dimensions are scaled.
+func scaledSize(width, height int, aspect Aspect, scale float64) (int, int) {
+	w, h := float64(width), float64(height)
+
+	if aspect > 0 {
+		w = h * float64(aspect)
+	}
+
+	return int(math.Max(1, math.Round(w*scale))), int(math.Max(1, math.Round(h*scale)))
+}
+
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+
+	switch {
+	case x < 1:
+		return (3*x*x*x - 5*x*x + 2) / 2
+	case x < 2:
+		return (-x*x*x + 5*x*x - 8*x + 4) / 2
+	}
+
+	return 0
+}
+
+// Source pixels and their weights contributing to one destination pixel.
+type contribution struct {
+	index  []int
+	weight []float64
+}
+
+// Weights for resampling a row or column of size src to size dst. The filter
+// is widened when downscaling to avoid aliasing.
+func contributions(src, dst int) []contribution {
+	ratio := float64(src) / float64(dst)
+	width := math.Max(ratio, 1)
+	support := 2 * width
+
+	c := make([]contribution, dst)
+
+	for i := range c {
+		center := (float64(i)+0.5)*ratio - 0.5
+		sum := 0.0
+
+		for j := int(math.Ceil(center - support)); j <= int(math.Floor(center+support)); j++ {
+			w := catmullRom((float64(j) - center) / width)
+			if w == 0 {
+				continue
+			}
+
+			// Clamp to the edge pixels.
+			index := j
+			if index < 0 {
+				index = 0
+			} else if index >= src {
+				index = src - 1
+			}
+
+			c[i].index = append(c[i].index, index)
+			c[i].weight = append(c[i].weight, w)
+			sum += w
+		}
+
+		for k := range c[i].weight {
+			c[i].weight[k] /= sum
+		}
+	}
+
+	return c
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(255, v))
+}
+
+// Resample img to the given size with a separable Catmull-Rom filter. Colour
+// channels are filtered premultiplied by alpha so transparent pixels don't
+// bleed into their neighbours.
+func resample(img image.Image, width, height int) *image.NRGBA {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+
+	src := make([]float64, sw*sh*4)
+
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			c := toNRGBA(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			a := float64(c.A) / 255
+			p := src[(y*sw+x)*4:]
+			p[0], p[1], p[2], p[3] = float64(c.R)*a, float64(c.G)*a, float64(c.B)*a, float64(c.A)
+		}
+	}
+
+	// Horizontal pass into a buffer of width x source height.
+	horizontal := make([]float64, width*sh*4)
+
+	for i, c := range contributions(sw, width) {
+		for y := 0; y < sh; y++ {
+			p := horizontal[(y*width+i)*4:]
+
+			for k, index := range c.index {
+				s := src[(y*sw+index)*4:]
+
+				for ch := 0; ch < 4; ch++ {
+					p[ch] += s[ch] * c.weight[k]
+				}
+			}
+		}
+	}
+
+	// Vertical pass into the destination.
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for i, c := range contributions(sh, height) {
+		for x := 0; x < width; x++ {
+			var p [4]float64
+
+			for k, index := range c.index {
+				s := horizontal[(index*width+x)*4:]
+
+				for ch := 0; ch < 4; ch++ {
+					p[ch] += s[ch] * c.weight[k]
+				}
+			}
+
+			a := clamp(p[3])
+			d := dst.Pix[dst.PixOffset(x, i):]
+			d[3] = uint8(math.Round(a))
+
+			if a > 0 {
+				for ch := 0; ch < 3; ch++ {
+					d[ch] = uint8(math.Round(clamp(p[ch] * 255 / a)))
+				}
+			}
+		}
+	}
+
+	return dst
+}
@@ -2,197 +2,337 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"flag"
 	"fmt"
 	"image"
 	"image/png"
 	"io"
 	"log"
-	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/dstien/dutils/xbdm"
 )
 
 const (
-	FilenameFormat    = "xbss-2006-01-02_15-04-05.000.png"
-	DebugBiosPort     = 731
-	ResponseOk        = "200- OK"
-	ResponseQuit      = "200- bye"
-	ResponseBanner    = "201- connected"
-	ResponseBinary    = "203- binary response follows"
-	CommandScreenshot = "screenshot"
-	CommandQuit       = "bye"
-	HeaderScreenshot  = "pitch=0x%x width=0x%x height=0x%x format=0x%x, framebuffersize=0x%x"
-	MessageSuffix     = "\r\n"
-	FormatBGRA        = 18
+	FilenameFormat = "xbss-2006-01-02_15-04-05.000.png"
 )
 
 var (
-	filename string
-	verbose  bool
+	filename  string
+	encoding  Encoding
+	quality   int
+	count     int
+	interval  time.Duration
+	opaque    bool
+	aspect    Aspect
+	scale     float64
+	verbose   bool
+	compare   string
+	tolerance int
+	hosts     string
+	workers   int
+
+	// Reference image loaded from the compare filename.
+	golden image.Image
+
+	// Output filenames include the host if there are several.
+	multiple bool
+
+	// Named consoles and the default console.
+	config *xbdm.Config
 )
 
-func bgra2rgba(data []byte, pitch, width, height int) {
-	for i := 0; i < pitch*height; i += pitch / width {
-		data[i], data[i+2] = data[i+2], data[i]
+// Name the output after the host if screenshots are taken from more than one
+// console, and number it from 1 if more than one screenshot is taken.
+// Animations are a single file.
+func decorate(name, host string, seq int) string {
+	if name == "-" {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	if multiple {
+		base += "-" + strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(host)
 	}
+
+	if count > 1 && !encoding.isAnimation() {
+		base += fmt.Sprintf("-%0*d", len(strconv.Itoa(count)), seq)
+	}
+
+	return base + ext
 }
 
-func writeImage(data []byte, pitch, width, height int) {
-	bgra2rgba(data, pitch, width, height)
-	img := &image.RGBA{data, pitch, image.Rect(0, 0, width, height)}
+func defaultName(start time.Time) string {
+	return strings.TrimSuffix(start.Format(FilenameFormat), filepath.Ext(FilenameFormat)) + encoding.extension()
+}
 
+// Output filename for the given shot in a series started at start.
+func outputName(start time.Time, host string, seq int) string {
 	if filename == "" {
-		filename = time.Now().Format(FilenameFormat)
+		return decorate(defaultName(start), host, seq)
 	}
 
-	file, err := os.Create(filename)
+	return decorate(filename, host, seq)
+}
 
-	if err != nil {
-		log.Fatal("Couldn't create output file: ", err)
+// Diff images are always PNG, named after the screenshot or the default
+// filename if the screenshot is written to stdout.
+func diffName(start time.Time, host string, seq int) string {
+	name := filename
+	if name == "" || name == "-" {
+		name = defaultName(start)
 	}
 
-	defer file.Close()
+	name = decorate(name, host, seq)
 
-	filewriter := bufio.NewWriter(file)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "-diff.png"
+}
 
-	err = png.Encode(filewriter, img)
+// Write to the named file, or stdout if the name is "-". Filenames are printed
+// when done, to stderr if stdout is used for image data.
+func writeOutput(name string, encode func(w io.Writer) error) error {
+	out := os.Stdout
 
-	if err != nil {
-		log.Fatal("PNG encoding failed: ", err)
-	}
+	if name != "-" {
+		file, err := os.Create(name)
 
-	fmt.Println(filename)
-}
+		if err != nil {
+			return fmt.Errorf("Couldn't create output file: %w", err)
+		}
 
-func connect(host string) (conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, err error) {
-	socket := fmt.Sprintf("%s:%d", host, DebugBiosPort)
+		defer file.Close()
 
-	if verbose {
-		log.Printf("Connecting to %s", socket)
+		out = file
 	}
 
-	conn, err = net.Dial("tcp4", socket)
-	if err != nil {
-		return nil, nil, nil, err
-	}
+	filewriter := bufio.NewWriter(out)
 
-	reader = bufio.NewReader(conn)
-	writer = bufio.NewWriter(conn)
+	err := encode(filewriter)
 
-	_, err = readResponse(reader, ResponseBanner)
 	if err != nil {
-		defer conn.Close()
-		return nil, nil, nil, fmt.Errorf("Error reading protocol banner: %s", err)
+		return fmt.Errorf("Encoding failed: %w", err)
 	}
 
-	return conn, reader, writer, err
-}
+	err = filewriter.Flush()
 
-func readResponse(reader *bufio.Reader, expected string) (response string, err error) {
-	response, err = reader.ReadString('\n')
 	if err != nil {
-		return "", err
+		return fmt.Errorf("Couldn't write output: %w", err)
 	}
 
-	if strings.HasSuffix(response, MessageSuffix) {
-		response = response[:len(response)-len(MessageSuffix)]
+	if filename == "-" && name != "-" {
+		fmt.Fprintln(os.Stderr, name)
+	} else if name != "-" {
+		fmt.Println(name)
 	}
 
-	if verbose {
-		log.Printf("Received response \"%s\"", response)
-	}
-
-	if expected != "" && response != expected {
-		err = fmt.Errorf("Got \"%s\", expected \"%s\".", response, expected)
-	}
+	return nil
+}
 
-	return response, err
+func writeImage(img image.Image, name string) error {
+	return writeOutput(name, func(w io.Writer) error {
+		return encodeImage(w, img, encoding)
+	})
 }
 
-func sendCommand(writer *bufio.Writer, reader *bufio.Reader, command, expected string) (response string, err error) {
+func capture(client *xbdm.Client) (image.Image, error) {
+	ss, err := client.Screenshot()
+	if err != nil {
+		return nil, err
+	}
+
 	if verbose {
-		log.Printf("Sending command \"%s\"", command)
+		fmt.Fprintf(os.Stderr, "\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n\n", "Pitch", ss.Pitch, "Width", ss.Width, "Height", ss.Height, "Format", ss.Format, "Framebuffer size", ss.FramebufferSize)
 	}
 
-	_, err = writer.WriteString(command + MessageSuffix)
+	img, err := decodeImage(ss.Data, ss.Pitch, ss.Width, ss.Height, ss.Format, opaque)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	err = writer.Flush()
-	if err != nil {
-		return "", err
+	if width, height := scaledSize(ss.Width, ss.Height, aspect, scale); width != ss.Width || height != ss.Height {
+		if verbose {
+			log.Printf("Scaling to %dx%d", width, height)
+		}
+
+		return resample(img, width, height), nil
 	}
 
-	return readResponse(reader, expected)
+	return img, nil
 }
 
-func screenshot(host string) {
-	conn, reader, writer, err := connect(host)
+// Compare the screenshot to the golden image and print a summary. A diff image
+// is written if it doesn't match.
+func matches(img image.Image, host, diff string) (bool, error) {
+	comparison, err := compareImages(img, golden, tolerance)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 
-	defer conn.Close()
-
-	_, err = sendCommand(writer, reader, CommandScreenshot, ResponseBinary)
-	if err != nil {
-		log.Fatalf("Command \"%s\" failed: %s", CommandScreenshot, err)
+	if multiple {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", host, comparison)
+	} else {
+		fmt.Fprintln(os.Stderr, comparison)
 	}
 
-	header, err := readResponse(reader, "")
-	if err != nil {
-		log.Fatal("Couldn't read screenshot header: ", err)
+	if comparison.Mismatched == 0 {
+		return true, nil
 	}
 
-	var pitch, width, height, format, fbsize int
-	fmt.Sscanf(header, HeaderScreenshot, &pitch, &width, &height, &format, &fbsize)
+	return false, writeOutput(diff, func(w io.Writer) error {
+		return png.Encode(w, comparison.Diff)
+	})
+}
 
-	if verbose {
-		fmt.Fprintf(os.Stderr, "\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n%-16s: %7d\n\n", "Pitch", pitch, "Width", width, "Height", height, "Format", format, "Framebuffer size", fbsize)
+func screenshot(host string) error {
+	client, err := xbdm.NewDialer(verbose, config).Dial(host)
+	if err != nil {
+		return err
 	}
 
-	if pitch == 0 || width == 0 || height == 0 || format != FormatBGRA || fbsize == 0 {
-		log.Fatal("Invalid image format")
+	defer client.Close()
+
+	// Shots are scheduled relative to the first one, so slow captures don't
+	// accumulate drift.
+	start := time.Now()
+	animate := encoding.isAnimation()
+	mismatched := 0
+
+	var frames []image.Image
+	var times []time.Time
+
+	for i := 0; i < count; i++ {
+		time.Sleep(time.Until(start.Add(time.Duration(i) * interval)))
+
+		taken := time.Now()
+
+		img, err := capture(client)
+		if err != nil {
+			return err
+		}
+
+		if animate {
+			frames = append(frames, img)
+			times = append(times, taken)
+		} else if err = writeImage(img, outputName(start, host, i+1)); err != nil {
+			return err
+		}
+
+		if golden != nil {
+			ok, err := matches(img, host, diffName(start, host, i+1))
+			if err != nil {
+				return err
+			} else if !ok {
+				mismatched++
+			}
+		}
 	}
 
-	buf := bytes.NewBuffer(nil)
-	buf.Grow(fbsize)
-
-	_, err = io.CopyN(buf, reader, int64(fbsize))
+	err = client.Quit()
 	if err != nil {
-		log.Fatal("Reading image data failed: ", err)
+		return fmt.Errorf("Farewell failed: %w", err)
 	}
 
-	writeImage(buf.Bytes(), pitch, width, height)
+	if animate {
+		err = writeAnimation(frames, frameDelays(times), outputName(start, host, 1))
+		if err != nil {
+			return err
+		}
+	}
 
-	_, err = sendCommand(writer, reader, CommandQuit, ResponseQuit)
-	if err != nil {
-		log.Fatal("Farewell failed: ", err)
+	if mismatched > 0 {
+		return fmt.Errorf("%d of %d screenshots don't match \"%s\"", mismatched, count, compare)
 	}
+
+	return nil
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [-f filename.png] [-v] host\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [-f filename|-] [-format format] [-quality 1-100] [-n count] [-interval duration] [-opaque] [-aspect W:H] [-scale factor] [-compare golden.png [-tolerance 0-255]] [-hosts file] [-j workers] [-v] [host...]\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
 func init() {
 	flag.BoolVar(&verbose, "v", false, "verbose")
-	flag.StringVar(&filename, "f", "", "output filename")
+	flag.StringVar(&filename, "f", "", "output filename, \"-\" for stdout")
+	flag.Var(&encoding, "format", fmt.Sprintf("image format, accepted values: %s", encodingList()))
+	flag.IntVar(&quality, "quality", 90, "JPEG quality")
+	flag.IntVar(&count, "n", 1, "number of screenshots to take")
+	flag.DurationVar(&interval, "interval", 0, "time between screenshots")
+	flag.BoolVar(&opaque, "opaque", false, "ignore the framebuffer alpha channel")
+	flag.Var(&aspect, "aspect", "resample to display aspect ratio, e.g. \"4:3\" or \"16:9\"")
+	flag.Float64Var(&scale, "scale", 1, "resample by factor")
+	flag.StringVar(&compare, "compare", "", "reference image to compare the screenshot to")
+	flag.IntVar(&tolerance, "tolerance", 0, "maximum difference per colour channel when comparing")
+	flag.StringVar(&hosts, "hosts", "", "file listing hosts to capture from, one per line")
+	flag.IntVar(&workers, "j", xbdm.DefaultWorkers, "maximum number of consoles captured from concurrently")
 	flag.Usage = usage
 }
 
 func main() {
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	config = xbdm.UserConfig()
+
+	targets := flag.Args()
+
+	if hosts != "" {
+		list, err := xbdm.ReadHosts(hosts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		targets = append(targets, list...)
+	}
+
+	if len(targets) == 0 && config.DefaultConsole() != "" {
+		targets = []string{config.DefaultConsole()}
+	}
+
+	if len(targets) == 0 || count < 1 || quality < 1 || quality > 100 || tolerance < 0 || tolerance > 255 || scale <= 0 {
 		usage()
 	}
 
-	screenshot(flag.Args()[0])
+	encoding = encoding.resolve(filename)
+	multiple = len(targets) > 1
+
+	if multiple && filename == "-" {
+		log.Fatal("Writing screenshots from multiple consoles to stdout is not supported")
+	}
+
+	if count > 1 && !encoding.isAnimation() && filename == "-" {
+		log.Fatal("Writing a series of screenshots to stdout is only supported as an animation")
+	}
+
+	if compare != "" {
+		if encoding.isAnimation() {
+			log.Fatal("Comparing animations is not supported")
+		}
+
+		var err error
+
+		golden, err = loadImage(compare)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	results := xbdm.FanOut(targets, workers, screenshot)
+
+	// A single console fails without a table, as before.
+	if multiple {
+		xbdm.WriteResults(os.Stderr, results)
+	} else if results[0].Err != nil {
+		log.Print(results[0].Err)
+	}
+
+	if xbdm.Failed(results) > 0 {
+		os.Exit(1)
+	}
 }
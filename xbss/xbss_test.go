@@ -0,0 +1,225 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstien/dutils/xbdm"
+	"github.com/dstien/dutils/xbdm/xbdmtest"
+)
+
+// Start a fake console serving a small gradient.
+func newServer(t *testing.T) *xbdmtest.Server {
+	t.Helper()
+
+	server, err := xbdmtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetScreen(xbdmtest.NewScreen(4, 3))
+
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+// Reset the flags changed by the tests and write to a file in a temporary
+// directory.
+func resetFlags(t *testing.T) {
+	filename = filepath.Join(t.TempDir(), "shot.png")
+	encoding = PNG
+	count, interval = 1, 0
+	opaque, aspect, scale = false, 0, 1
+	golden, multiple = nil, false
+}
+
+// Gradient pixel of xbdmtest.NewScreen.
+func gradient(x, y int) color.NRGBA {
+	return color.NRGBA{byte(x + y), byte(y), byte(x), 0xff}
+}
+
+// Copy screen with extra bytes at the end of each row.
+func padRows(screen *xbdmtest.Screen, padding int) *xbdmtest.Screen {
+	padded := *screen
+	padded.Pitch += padding
+	padded.Data = make([]byte, padded.Pitch*padded.Height)
+
+	for y := 0; y < screen.Height; y++ {
+		copy(padded.Data[y*padded.Pitch:], screen.Data[y*screen.Pitch:(y+1)*screen.Pitch])
+	}
+
+	return &padded
+}
+
+func TestScreenshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(s *xbdmtest.Server)
+		status xbdm.Status
+		err    bool
+	}{
+		{name: "gradient"},
+		{
+			name:  "row padding",
+			setup: func(s *xbdmtest.Server) { s.SetScreen(padRows(xbdmtest.NewScreen(4, 3), 8)) },
+		},
+		{
+			name: "no framebuffer", status: xbdm.StatusDataNotAvailable,
+			setup: func(s *xbdmtest.Server) { s.SetScreen(nil) },
+		},
+		{
+			name: "unknown command", status: xbdm.StatusUnknownCommand,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("screenshot", xbdmtest.Respond(xbdm.StatusUnknownCommand, "unknown command"))
+			},
+		},
+		{
+			name: "incomplete header", err: true,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("screenshot", xbdmtest.Raw("203- binary response follows\r\npitch=0x10 width=0x4\r\n"))
+			},
+		},
+		{
+			name: "malformed header", err: true,
+			setup: func(s *xbdmtest.Server) {
+				s.Handle("screenshot", xbdmtest.Raw("203- binary response follows\r\npitch=\"0x10\r\n"))
+			},
+		},
+		{
+			name: "short payload", err: true,
+			setup: func(s *xbdmtest.Server) {
+				screen := xbdmtest.NewScreen(4, 3)
+
+				s.Handle("screenshot", func(c *xbdmtest.Conn, cmd *xbdmtest.Command) {
+					c.Respond(xbdm.StatusBinary, "binary response follows")
+					c.WriteLine(screen.Header())
+					c.Write(screen.Data[:len(screen.Data)/2])
+					c.Close()
+				})
+			},
+		},
+		{
+			name: "unsupported format", err: true,
+			setup: func(s *xbdmtest.Server) {
+				screen := xbdmtest.NewScreen(4, 3)
+				screen.Format = 0x99
+				s.SetScreen(screen)
+			},
+		},
+		{
+			name: "hangup", err: true,
+			setup: func(s *xbdmtest.Server) { s.Handle("screenshot", xbdmtest.Hangup()) },
+		},
+		{
+			name: "malformed banner", err: true,
+			setup: func(s *xbdmtest.Server) { s.SetBanner("hello") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+
+			server := newServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			err := screenshot(server.Addr())
+
+			if tt.err || tt.status != 0 {
+				if err == nil {
+					t.Fatal("Screenshot succeeded, want error")
+				} else if tt.status != 0 && !xbdm.IsStatus(err, tt.status) {
+					t.Errorf("Got %v, want status %s", err, tt.status)
+				}
+
+				if _, err := os.Stat(filename); err == nil {
+					t.Error("Output written after failing")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img, err := loadImage(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size := img.Bounds().Size(); size.X != 4 || size.Y != 3 {
+				t.Fatalf("Image is %dx%d, want 4x3", size.X, size.Y)
+			}
+
+			for y := 0; y < 3; y++ {
+				for x := 0; x < 4; x++ {
+					if got := toNRGBA(img.At(x, y)); got != gradient(x, y) {
+						t.Errorf("Pixel (%d, %d) = %v, want %v", x, y, got, gradient(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScreenshotSeries(t *testing.T) {
+	resetFlags(t)
+	count = 3
+
+	server := newServer(t)
+
+	err := screenshot(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Dir(filename)
+
+	for _, name := range []string{"shot-1.png", "shot-2.png", "shot-3.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestScreenshotCompare(t *testing.T) {
+	resetFlags(t)
+
+	server := newServer(t)
+
+	err := screenshot(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden, err = loadImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := filepath.Join(filepath.Dir(filename), "shot-diff.png")
+
+	err = screenshot(server.Addr())
+	if err != nil {
+		t.Fatalf("Identical screenshot: %v", err)
+	} else if _, err := os.Stat(diff); err == nil {
+		t.Error("Diff written for identical screenshot")
+	}
+
+	changed := xbdmtest.NewScreen(4, 3)
+	changed.Data[0] ^= 0xff
+	server.SetScreen(changed)
+
+	err = screenshot(server.Addr())
+	if err == nil {
+		t.Error("Changed screenshot matches")
+	} else if _, err := os.Stat(diff); err != nil {
+		t.Error(err)
+	}
+}